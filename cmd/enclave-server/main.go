@@ -4,10 +4,12 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"log"
 	"os"
 	"os/signal"
-	"path/filepath"
+	"strings"
 
 	"github.com/symbolicsoft/enclave/v2/internal/server"
 	"github.com/symbolicsoft/enclave/v2/internal/store"
@@ -16,23 +18,101 @@ import (
 
 func main() {
 	fmt.Println("enclave-server", version.VERSION_SERVER)
-	handleSigInterrupt()
+	config, err := parseConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if rounded := config.WithPadBucket(); rounded.NotebookBytesMax != config.NotebookBytesMax {
+		log.Printf("warning: notebook size limit %d is not a padding bucket size, rounding it down to %d bytes", config.NotebookBytesMax, rounded.NotebookBytesMax)
+		config = rounded
+	}
+	err = config.Validate()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+	db, err := store.Open(config.DatabaseBackend, config.DatabasePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not open %s database %s: %v\n", config.DatabaseBackend, config.DatabasePath, err)
+		os.Exit(1)
+	}
+	err = store.BackfillDecoyLinks(db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not backfill decoy links: %v\n", err)
+		os.Exit(1)
+	}
+	handleSigInterrupt(db)
 	server := server.EnclaveServer{
-		CertFilePath:  filepath.Join("/", "home", "nadim", "certs", "enclave.sh.crt"),
-		KeyFilePath:   filepath.Join("/", "home", "nadim", "certs", "enclave.sh.key"),
-		ListenAddress: "172.233.242.130",
-		ListenPort:    7070,
+		CertFilePath:      config.CertFilePath,
+		KeyFilePath:       config.KeyFilePath,
+		ListenAddress:     config.ListenAddress,
+		ListenPort:        config.ListenPort,
+		NotebookBytesMax:  config.NotebookBytesMax,
+		LegacyWritesUntil: config.LegacyWritesUntil,
+		Store:             db,
 	}
+	fmt.Printf("listening on %s:%d\n", config.ListenAddress, config.ListenPort)
 	server.Start()
 }
 
-func handleSigInterrupt() {
+func parseConfig() (server.Config, error) {
+	defaults := server.DefaultConfig()
+	configFilePath := flag.String("config", os.Getenv("ENCLAVE_SERVER_CONFIG"), "path to a JSON configuration file")
+	certFilePath := flag.String("cert", defaults.CertFilePath, "path to the TLS certificate (PEM)")
+	keyFilePath := flag.String("key", defaults.KeyFilePath, "path to the TLS private key (PEM)")
+	listenAddress := flag.String("listen", defaults.ListenAddress, "address to listen on")
+	listenPort := flag.Int("port", defaults.ListenPort, "port to listen on")
+	databaseBackend := flag.String("db-backend", defaults.DatabaseBackend, "storage backend ("+strings.Join(store.BACKENDS, ", ")+")")
+	databasePath := flag.String("db", defaults.DatabasePath, "path to the notebook database")
+	notebookBytesMax := flag.Int("notebook-bytes-max", defaults.NotebookBytesMax, "maximum encrypted notebook size in bytes")
+	legacyWritesUntil := flag.String("legacy-writes-until", "", "time after which notebooks without a registered write key refuse unsigned writes (RFC 3339 or YYYY-MM-DD)")
+	flag.Parse()
+	config, err := server.LoadConfig(*configFilePath)
+	if err != nil {
+		return server.Config{}, err
+	}
+	config, err = config.WithEnv()
+	if err != nil {
+		return server.Config{}, err
+	}
+	var errFlag error
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "cert":
+			config.CertFilePath = *certFilePath
+		case "key":
+			config.KeyFilePath = *keyFilePath
+		case "listen":
+			config.ListenAddress = *listenAddress
+		case "port":
+			config.ListenPort = *listenPort
+		case "db-backend":
+			config.DatabaseBackend = *databaseBackend
+		case "db":
+			config.DatabasePath = *databasePath
+		case "notebook-bytes-max":
+			config.NotebookBytesMax = *notebookBytesMax
+		case "legacy-writes-until":
+			config.LegacyWritesUntil, errFlag = server.ParseTime(*legacyWritesUntil)
+			if errFlag != nil {
+				errFlag = fmt.Errorf("-legacy-writes-until: %v", errFlag)
+			}
+		}
+	})
+	return config, errFlag
+}
+
+func handleSigInterrupt(db store.Backend) {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
 	go func() {
 		for range c {
 			fmt.Println("closing database...")
-			store.CloseDatabase()
+			err := db.Close()
+			if err != nil {
+				log.Fatal("could not close database")
+			}
 			os.Exit(0)
 		}
 	}()
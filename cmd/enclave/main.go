@@ -3,8 +3,70 @@
 
 package main
 
-import "github.com/symbolicsoft/enclave/v2/internal/tui"
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/symbolicsoft/enclave/v2/internal/cli"
+	"github.com/symbolicsoft/enclave/v2/internal/client"
+	"github.com/symbolicsoft/enclave/v2/internal/config"
+	"github.com/symbolicsoft/enclave/v2/internal/tui"
+)
 
 func main() {
-	tui.RunProgram()
+	profileName := flag.String("profile", os.Getenv("ENCLAVE_PROFILE"), "server profile to use from client.json")
+	serverAddress := flag.String("server", os.Getenv("ENCLAVE_SERVER"), "server address (host:port)")
+	serverCert := flag.String("server-cert", os.Getenv("ENCLAVE_SERVER_CERT"), "path to the pinned server certificate (PEM)")
+	serverSpki := flag.String("server-spki", os.Getenv("ENCLAVE_SERVER_SPKI"), "pinned SHA-256 hash of the server's SPKI (hex or base64)")
+	autosave := flag.Duration("autosave", envDuration("ENCLAVE_AUTOSAVE", tui.AUTOSAVE_DELAY), "save this long after the last edit (0 disables autosave)")
+	lockAfter := flag.Duration("lock", envDuration("ENCLAVE_LOCK", tui.LOCK_DELAY), "lock the notebook after this long without input (0 disables locking)")
+	panicKey := flag.String("panic-key", envString("ENCLAVE_PANIC_KEY", tui.PANIC_KEY), "key that deletes the stored keys and exits immediately (empty disables it)")
+	panicDelete := flag.Bool("panic-delete", os.Getenv("ENCLAVE_PANIC_DELETE") == "1", "also delete the notebook from the server when the panic key is pressed")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: enclave [flags] [command]")
+		flag.PrintDefaults()
+		cli.Usage()
+	}
+	flag.Parse()
+	profile, err := client.LoadProfile(config.ClientConfigPath(), *profileName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	err = client.SetProfile(profile.WithOverrides(*serverAddress, *serverCert, *serverSpki))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if flag.NArg() > 0 {
+		os.Exit(cli.Run(flag.Args()))
+	}
+	tui.RunProgram(tui.Options{
+		Autosave:    *autosave,
+		LockAfter:   *lockAfter,
+		PanicKey:    *panicKey,
+		PanicDelete: *panicDelete,
+	})
+}
+
+func envString(name string, fallback string) string {
+	if env, ok := os.LookupEnv(name); ok {
+		return env
+	}
+	return fallback
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	env := os.Getenv(name)
+	if len(env) == 0 {
+		return fallback
+	}
+	duration, err := time.ParseDuration(env)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid %s: %s\n", name, err)
+		os.Exit(1)
+	}
+	return duration
 }
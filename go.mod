@@ -10,6 +10,7 @@ require (
 	github.com/charmbracelet/huh v0.2.3
 	github.com/charmbracelet/huh/spinner v0.0.0-20231222231237-4bd4657a36ac
 	github.com/charmbracelet/lipgloss v0.9.1
+	github.com/mattn/go-sqlite3 v1.14.19
 	github.com/syndtr/goleveldb v1.0.0
 	golang.org/x/crypto v0.17.0
 	google.golang.org/grpc v1.60.1
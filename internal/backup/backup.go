@@ -0,0 +1,139 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/symbolicsoft/enclave/v2/internal/ciphers"
+	"github.com/symbolicsoft/enclave/v2/internal/notebook"
+	enclaveProto "github.com/symbolicsoft/enclave/v2/internal/proto"
+)
+
+const BACKUP_FORMAT = "enclave-backup"
+const BACKUP_VERSION = 1
+const BACKUP_EXTENSION = ".enclave"
+const SUBKEYS_BLAKE2X = "blake2s-xof"
+const CIPHER_XCHACHA20POLY1305 = "xchacha20-poly1305"
+
+// File is a self-describing backup: it records everything besides the
+// passphrase that is needed to derive USK-ED and decrypt the notebook.
+type File struct {
+	Format         string `json:"format"`
+	Version        int    `json:"version"`
+	Created        int64  `json:"created"`
+	Kdf            Kdf    `json:"kdf"`
+	Subkeys        string `json:"subkeys"`
+	Cipher         string `json:"cipher"`
+	NotebookFormat uint32 `json:"notebookFormat,omitempty"`
+	Nonce          []byte `json:"nonce"`
+	Data           []byte `json:"data"`
+}
+
+type Kdf struct {
+	Version   uint32 `json:"version,omitempty"`
+	Algorithm string `json:"algorithm"`
+	Salt      []byte `json:"salt"`
+	N         int    `json:"n,omitempty"`
+	R         int    `json:"r,omitempty"`
+	P         int    `json:"p,omitempty"`
+	Time      uint32 `json:"time,omitempty"`
+	Memory    uint32 `json:"memory,omitempty"`
+	Threads   uint8  `json:"threads,omitempty"`
+}
+
+func Create(subkeys [3]ciphers.Subkey, nb *enclaveProto.Notebook) (*File, error) {
+	kdf, err := ciphers.KdfVersion(nb.KdfVersion)
+	if err != nil {
+		return &File{}, err
+	}
+	enb, err := notebook.Encrypt(subkeys, nb, 0)
+	if err != nil {
+		return &File{}, err
+	}
+	return &File{
+		Format:  BACKUP_FORMAT,
+		Version: BACKUP_VERSION,
+		Created: time.Now().Unix(),
+		Kdf: Kdf{
+			Version:   kdf.Version,
+			Algorithm: kdf.Algorithm,
+			Salt:      kdf.Salt,
+			N:         kdf.N,
+			R:         kdf.R,
+			P:         kdf.P,
+			Time:      kdf.Time,
+			Memory:    kdf.Memory,
+			Threads:   kdf.Threads,
+		},
+		Subkeys:        SUBKEYS_BLAKE2X,
+		Cipher:         CIPHER_XCHACHA20POLY1305,
+		NotebookFormat: enb.Format,
+		Nonce:          enb.Nonce,
+		Data:           enb.Data,
+	}, nil
+}
+
+func Write(path string, f *File) error {
+	out, err := json.MarshalIndent(f, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(out, '\n'), 0o600)
+}
+
+func Read(path string) (*File, error) {
+	in, err := os.ReadFile(path)
+	if err != nil {
+		return &File{}, err
+	}
+	f := &File{}
+	err = json.Unmarshal(in, f)
+	if err != nil || f.Format != BACKUP_FORMAT {
+		return &File{}, errors.New("not an Enclave backup file")
+	}
+	if f.Version != BACKUP_VERSION {
+		return &File{}, fmt.Errorf("unsupported backup file version %d", f.Version)
+	}
+	if (f.Kdf.Algorithm != ciphers.KDF_SCRYPT && f.Kdf.Algorithm != ciphers.KDF_ARGON2ID) || f.Subkeys != SUBKEYS_BLAKE2X || f.Cipher != CIPHER_XCHACHA20POLY1305 {
+		return &File{}, errors.New("unsupported backup file algorithms")
+	}
+	return f, nil
+}
+
+// Open derives the notebook keys from passphrase with the parameters
+// recorded in f and decrypts its notebook.
+func Open(f *File, passphrase string) ([3]ciphers.Subkey, *enclaveProto.Notebook, error) {
+	userSecret, err := ciphers.Kdf{
+		Version:   f.Kdf.Version,
+		Algorithm: f.Kdf.Algorithm,
+		Salt:      f.Kdf.Salt,
+		N:         f.Kdf.N,
+		R:         f.Kdf.R,
+		P:         f.Kdf.P,
+		Time:      f.Kdf.Time,
+		Memory:    f.Kdf.Memory,
+		Threads:   f.Kdf.Threads,
+	}.Derive(passphrase)
+	if err != nil {
+		return [3]ciphers.Subkey{}, &enclaveProto.Notebook{}, err
+	}
+	subkeys, err := ciphers.DeriveSubkeys(userSecret)
+	if err != nil {
+		return [3]ciphers.Subkey{}, &enclaveProto.Notebook{}, err
+	}
+	nb, err := notebook.Decrypt(subkeys, &enclaveProto.EncryptedNotebook{
+		Data:   f.Data,
+		Nonce:  f.Nonce,
+		Format: f.NotebookFormat,
+	})
+	if err != nil {
+		return [3]ciphers.Subkey{}, &enclaveProto.Notebook{}, errors.New("could not decrypt backup: wrong passphrase or corrupted file")
+	}
+	return subkeys, nb, nil
+}
@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/symbolicsoft/enclave/v2/internal/ciphers"
+	"github.com/symbolicsoft/enclave/v2/internal/notebook"
+)
+
+// TEST_KDF stands in for the notebook's KDF so that tests derive keys
+// cheaply: Open only uses the parameters recorded in the file.
+var TEST_KDF = Kdf{
+	Version:   ciphers.KDF_CURRENT.Version,
+	Algorithm: ciphers.KDF_ARGON2ID,
+	Salt:      []byte(ciphers.ARGON2_SALT),
+	Time:      1,
+	Memory:    1024,
+	Threads:   1,
+}
+
+func newBackup(t *testing.T, passphrase string) (string, *File) {
+	t.Helper()
+	userSecret, err := ciphers.DeriveKeyArgon2id(passphrase, TEST_KDF.Salt, TEST_KDF.Time, TEST_KDF.Memory, TEST_KDF.Threads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subkeys, err := ciphers.DeriveSubkeys(userSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := Create(subkeys, notebook.Create())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Kdf.Version != ciphers.KDF_CURRENT.Version || f.Kdf.Memory != ciphers.KDF_CURRENT.Memory {
+		t.Fatalf("got KDF %v, want version %d", f.Kdf, ciphers.KDF_CURRENT.Version)
+	}
+	f.Kdf = TEST_KDF
+	path := filepath.Join(t.TempDir(), "notebook"+BACKUP_EXTENSION)
+	if err := Write(path, f); err != nil {
+		t.Fatal(err)
+	}
+	return path, f
+}
+
+func TestRoundTrip(t *testing.T) {
+	path, _ := newBackup(t, "correct horse")
+	f, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, nb, err := Open(f, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := notebook.Create()
+	if len(nb.Pages) != len(want.Pages) || nb.Pages[0].Body != want.Pages[0].Body || nb.KdfVersion != want.KdfVersion {
+		t.Fatalf("got %v, want %v", nb, want)
+	}
+	if _, _, err := Open(f, "wrong horse"); err == nil {
+		t.Fatal("opened with the wrong passphrase")
+	}
+	f.Data[0] ^= 1
+	if _, _, err := Open(f, "correct horse"); err == nil {
+		t.Fatal("opened a corrupted backup")
+	}
+}
+
+func TestReadUnsupported(t *testing.T) {
+	for name, tamper := range map[string]func(f *File){
+		"format":    func(f *File) { f.Format = "other" },
+		"version":   func(f *File) { f.Version = BACKUP_VERSION + 1 },
+		"algorithm": func(f *File) { f.Kdf.Algorithm = "pbkdf2" },
+		"subkeys":   func(f *File) { f.Subkeys = "hkdf" },
+		"cipher":    func(f *File) { f.Cipher = "aes-256-gcm" },
+	} {
+		path, f := newBackup(t, "correct horse")
+		tamper(f)
+		if err := Write(path, f); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Read(path); err == nil {
+			t.Fatalf("read a backup with an unsupported %s", name)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(path); err == nil {
+		t.Fatal("read a file that is not a backup")
+	}
+	// Parameters beyond the KDF limits are refused before deriving.
+	_, f := newBackup(t, "correct horse")
+	f.Kdf.Memory = ciphers.ARGON2_MEMORY_MAX + 1
+	if _, _, err := Open(f, "correct horse"); err == nil {
+		t.Fatal("opened a backup with oversized KDF parameters")
+	}
+}
@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package cache
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/symbolicsoft/enclave/v2/internal/ciphers"
+	"github.com/symbolicsoft/enclave/v2/internal/config"
+	enclaveProto "github.com/symbolicsoft/enclave/v2/internal/proto"
+	"golang.org/x/crypto/blake2s"
+	"google.golang.org/protobuf/proto"
+)
+
+const CACHEFILE_HEADER = "enclave-cache"
+const CACHEFILE_VERSION = 1
+
+func EnsureDir() string {
+	cachePath := filepath.Join(config.EnsureDir(), "cache")
+	if _, err := os.Stat(cachePath); os.IsNotExist(err) {
+		os.MkdirAll(cachePath, 0o700)
+	}
+	return cachePath
+}
+
+// Purge removes the cached copies of every notebook.
+func Purge() error {
+	return os.RemoveAll(filepath.Join(config.EnsureDir(), "cache"))
+}
+
+func Read(subkeys [3]ciphers.Subkey) (*enclaveProto.NotebookCache, error) {
+	cacheFileBytes, err := os.ReadFile(cachePath(subkeys[0]))
+	if os.IsNotExist(err) {
+		return &enclaveProto.NotebookCache{}, nil
+	}
+	if err != nil {
+		return &enclaveProto.NotebookCache{}, err
+	}
+	cacheFile := strings.Split(string(cacheFileBytes), "\n")
+	if len(cacheFile) < 3 || cacheFile[0] != cachefileHeader() {
+		return &enclaveProto.NotebookCache{}, errors.New("could not decode cache file")
+	}
+	nonce, errNonce := hex.DecodeString(cacheFile[1])
+	data, errData := hex.DecodeString(cacheFile[2])
+	if (errNonce != nil) || (errData != nil) {
+		return &enclaveProto.NotebookCache{}, errors.New("could not decode cache file")
+	}
+	pt, err := ciphers.Decrypt(subkeys[1], ciphers.Ciphertext{
+		Data:  data,
+		Nonce: nonce,
+	}, []byte{})
+	if err != nil {
+		return &enclaveProto.NotebookCache{}, errors.New("could not decrypt cache file")
+	}
+	nc := &enclaveProto.NotebookCache{}
+	err = proto.Unmarshal(pt, nc)
+	if err != nil {
+		return &enclaveProto.NotebookCache{}, err
+	}
+	return nc, nil
+}
+
+func Write(subkeys [3]ciphers.Subkey, nc *enclaveProto.NotebookCache) error {
+	pt, err := proto.Marshal(nc)
+	if err != nil {
+		return err
+	}
+	ct, err := ciphers.Encrypt(subkeys[1], pt, []byte{})
+	if err != nil {
+		return err
+	}
+	cacheFilePath := cachePath(subkeys[0])
+	tmpPath := cacheFilePath + ".tmp"
+	err = os.WriteFile(tmpPath, []byte(strings.Join([]string{
+		cachefileHeader(),
+		hex.EncodeToString(ct.Nonce),
+		hex.EncodeToString(ct.Data),
+	}, "\n")), 0o600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, cacheFilePath)
+}
+
+func Delete(subkeys [3]ciphers.Subkey) {
+	os.Remove(cachePath(subkeys[0]))
+}
+
+func cachePath(uskId ciphers.Subkey) string {
+	// Cache files are named after a hash of USK-ID so that they do not
+	// reveal which notebook they belong to.
+	name := blake2s.Sum256(append([]byte(CACHEFILE_HEADER), uskId...))
+	return filepath.Join(EnsureDir(), hex.EncodeToString(name[:]))
+}
+
+func cachefileHeader() string {
+	return fmt.Sprintf("%s %d", CACHEFILE_HEADER, CACHEFILE_VERSION)
+}
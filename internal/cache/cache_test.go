@@ -0,0 +1,105 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package cache
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/symbolicsoft/enclave/v2/internal/ciphers"
+	enclaveProto "github.com/symbolicsoft/enclave/v2/internal/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+func newSubkeys(t *testing.T) [3]ciphers.Subkey {
+	t.Helper()
+	k := make([]byte, ciphers.SCRYPT_L)
+	rand.Read(k)
+	subkeys, err := ciphers.DeriveSubkeys(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return subkeys
+}
+
+func newCache(subkeys [3]ciphers.Subkey) *enclaveProto.NotebookCache {
+	return &enclaveProto.NotebookCache{
+		Synced: &enclaveProto.EncryptedNotebook{
+			NotebookId: subkeys[0],
+			Data:       []byte("synced"),
+			Revision:   3,
+		},
+		Pending: &enclaveProto.EncryptedNotebook{
+			NotebookId: subkeys[0],
+			Data:       []byte("pending"),
+			Revision:   3,
+		},
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	subkeys := newSubkeys(t)
+	nc, err := Read(subkeys)
+	if err != nil || nc.Synced != nil || nc.Pending != nil {
+		t.Fatalf("reading a missing cache: got %v, %v", nc, err)
+	}
+	want := newCache(subkeys)
+	if err := Write(subkeys, want); err != nil {
+		t.Fatal(err)
+	}
+	nc, err = Read(subkeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(nc, want) {
+		t.Fatalf("got %v, want %v", nc, want)
+	}
+	if strings.Contains(cachePath(subkeys[0]), hex.EncodeToString(subkeys[0])) {
+		t.Fatal("cache file name reveals the notebook identifier")
+	}
+	Delete(subkeys)
+	if _, err := os.Stat(cachePath(subkeys[0])); !os.IsNotExist(err) {
+		t.Fatalf("cache file left after deleting: %v", err)
+	}
+}
+
+func TestReadTampered(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	subkeys := newSubkeys(t)
+	if err := Write(subkeys, newCache(subkeys)); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(cachePath(subkeys[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(b), "\n")
+	data, _ := hex.DecodeString(lines[2])
+	data[0] ^= 1
+	for name, tampered := range map[string]string{
+		"data":   strings.Join([]string{lines[0], lines[1], hex.EncodeToString(data)}, "\n"),
+		"header": strings.Join([]string{"enclave-cache 0", lines[1], lines[2]}, "\n"),
+		"hex":    strings.Join([]string{lines[0], lines[1], "zz"}, "\n"),
+		"lines":  strings.Join(lines[:2], "\n"),
+	} {
+		if err := os.WriteFile(cachePath(subkeys[0]), []byte(tampered), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Read(subkeys); err == nil {
+			t.Fatalf("tampered %s: read succeeded", name)
+		}
+	}
+	// Another notebook's keys must not decrypt the file either.
+	if err := os.WriteFile(cachePath(subkeys[0]), b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	other := newSubkeys(t)
+	if _, err := Read([3]ciphers.Subkey{subkeys[0], other[1], other[2]}); err == nil {
+		t.Fatal("read succeeded under another key")
+	}
+}
@@ -4,7 +4,9 @@
 package ciphers
 
 import (
+	"crypto/ed25519"
 	"crypto/rand"
+	"encoding/binary"
 	"errors"
 	"fmt"
 
@@ -18,9 +20,15 @@ const SCRYPT_N = 1048576
 const SCRYPT_R = 8
 const SCRYPT_P = 1
 const SCRYPT_L = 32
+const SCRYPT_R_MAX = 32
+const SCRYPT_P_MAX = 16
 const SCRYPT_SALT = "DTWdTA8L9VZG5J8p5dNaUmrQ"
+const KDF_MEMORY_MAX = 1 << 30
 const SUBKEY_L = 32
 const PASSPHRASE_WORDS = 12
+const PIN_SALT_L = 24
+const WRITE_KEY_CONTEXT = "Enclave USK-WA"
+const NOTEBOOK_AD_CONTEXT = "Enclave Notebook"
 
 type Key []byte
 type Subkey []byte
@@ -35,6 +43,10 @@ func GeneratePassphrase() (string, error) {
 }
 
 func DeriveKey(passphrase string) (Key, error) {
+	return DeriveKeyWith(KDF_CURRENT, passphrase)
+}
+
+func DeriveKeyWith(kdf Kdf, passphrase string) (Key, error) {
 	spaces := 0
 	for _, char := range passphrase {
 		if char == ' ' {
@@ -44,41 +56,160 @@ func DeriveKey(passphrase string) (Key, error) {
 	if spaces < (PASSPHRASE_WORDS - 1) {
 		return []byte{}, fmt.Errorf("passphrase must have at least %d words", PASSPHRASE_WORDS)
 	}
-	salt := []byte(SCRYPT_SALT)
-	key, err := scrypt.Key([]byte(passphrase), salt, SCRYPT_N, SCRYPT_R, SCRYPT_P, SCRYPT_L)
+	return kdf.Derive(passphrase)
+}
+
+func DeriveKeyScrypt(passphrase string, salt []byte, n int, r int, p int) (Key, error) {
+	if n <= 1 || r <= 0 || p <= 0 {
+		return []byte{}, errors.New("scrypt parameters are too small")
+	}
+	// scrypt needs 128·N·r bytes of memory, so N and r are capped
+	// together rather than each on its own.
+	if r > SCRYPT_R_MAX || p > SCRYPT_P_MAX || n > KDF_MEMORY_MAX/(128*r) {
+		return []byte{}, errors.New("scrypt parameters are too large")
+	}
+	key, err := scrypt.Key([]byte(passphrase), salt, n, r, p, SCRYPT_L)
+	if err != nil {
+		return nil, err
+	}
+	return key, err
+}
+
+func DerivePinKey(pin string, salt []byte) (Key, error) {
+	if len(salt) != PIN_SALT_L {
+		return []byte{}, fmt.Errorf("PIN salt must be %d bytes", PIN_SALT_L)
+	}
+	key, err := scrypt.Key([]byte(pin), salt, SCRYPT_N, SCRYPT_R, SCRYPT_P, SCRYPT_L)
 	if err != nil {
 		return nil, err
 	}
 	return key, err
 }
 
-func DeriveSubkeys(k Key) ([2]Subkey, error) {
+func GeneratePinSalt() ([]byte, error) {
+	salt := make([]byte, PIN_SALT_L)
+	n, err := rand.Read(salt)
+	if n != PIN_SALT_L {
+		return []byte{}, fmt.Errorf("could not generate %d-byte salt", PIN_SALT_L)
+	}
+	if err != nil {
+		return []byte{}, err
+	}
+	return salt, err
+}
+
+func DeriveSubkeys(k Key) ([3]Subkey, error) {
 	if len(k) != SCRYPT_L {
-		return [2]Subkey{}, fmt.Errorf("derived key must be %d bytes", SUBKEY_L)
+		return [3]Subkey{}, fmt.Errorf("derived key must be %d bytes", SUBKEY_L)
 	}
 	blake2x, err := blake2s.NewXOF(SUBKEY_L*2, k)
 	if err != nil {
-		return [2]Subkey{}, err
+		return [3]Subkey{}, err
 	}
-	subkeys := [2]Subkey{make([]byte, SUBKEY_L), make([]byte, SUBKEY_L)}
+	subkeys := [3]Subkey{make([]byte, SUBKEY_L), make([]byte, SUBKEY_L), make([]byte, SUBKEY_L)}
 	skn0, err := blake2x.Read(subkeys[0])
 	if skn0 != SUBKEY_L {
-		return [2]Subkey{}, errors.New("could not derive full subkey")
+		return [3]Subkey{}, errors.New("could not derive full subkey")
 	}
 	if err != nil {
-		return [2]Subkey{}, err
+		return [3]Subkey{}, err
 	}
 	skn1, err := blake2x.Read(subkeys[1])
 	if skn1 != SUBKEY_L {
-		return [2]Subkey{}, errors.New("could not derive full subkey")
+		return [3]Subkey{}, errors.New("could not derive full subkey")
 	}
 	if err != nil {
-		return [2]Subkey{}, err
+		return [3]Subkey{}, err
+	}
+	// The write-authorization subkey comes from a separate XOF so that
+	// USK-ID and USK-ED stay the same as for notebooks created before it.
+	blake2xWa, err := blake2s.NewXOF(SUBKEY_L, k)
+	if err != nil {
+		return [3]Subkey{}, err
+	}
+	blake2xWa.Write([]byte(WRITE_KEY_CONTEXT))
+	skn2, err := blake2xWa.Read(subkeys[2])
+	if skn2 != SUBKEY_L {
+		return [3]Subkey{}, errors.New("could not derive full subkey")
+	}
+	if err != nil {
+		return [3]Subkey{}, err
 	}
 	return subkeys, err
 }
 
-func Encrypt(sk Subkey, pt []byte) (Ciphertext, error) {
+func Wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+func WriteKeyPair(sk Subkey) (ed25519.PublicKey, ed25519.PrivateKey, error) {
+	if len(sk) != ed25519.SeedSize {
+		return ed25519.PublicKey{}, ed25519.PrivateKey{}, fmt.Errorf("write-authorization key must be %d bytes", ed25519.SeedSize)
+	}
+	priv := ed25519.NewKeyFromSeed(sk)
+	return priv.Public().(ed25519.PublicKey), priv, nil
+}
+
+func SignWrite(sk Subkey, msg []byte) (ed25519.PublicKey, []byte, error) {
+	pub, priv, err := WriteKeyPair(sk)
+	if err != nil {
+		return ed25519.PublicKey{}, []byte{}, err
+	}
+	return pub, ed25519.Sign(priv, msg), nil
+}
+
+func VerifyWrite(pub []byte, msg []byte, sig []byte) bool {
+	if len(pub) != ed25519.PublicKeySize || len(sig) != ed25519.SignatureSize {
+		return false
+	}
+	return ed25519.Verify(pub, msg, sig)
+}
+
+func PutNotebookMessage(notebookId []byte, decoyFor []byte, revision uint64, nonce []byte, data []byte) []byte {
+	return writeMessage("PutNotebook", revision, notebookId, decoyFor, nonce, data)
+}
+
+func DeleteNotebookMessage(notebookId []byte, revision uint64) []byte {
+	return writeMessage("DeleteNotebook", revision, notebookId)
+}
+
+func SetDecoyMessage(notebookId []byte, decoyId []byte, revision uint64, deletePrevious bool) []byte {
+	deletePreviousByte := []byte{0}
+	if deletePrevious {
+		deletePreviousByte[0] = 1
+	}
+	return writeMessage("SetDecoy", revision, notebookId, decoyId, deletePreviousByte)
+}
+
+func RekeyNotebookMessage(notebookId []byte, newNotebookId []byte, revision uint64) []byte {
+	return writeMessage("RekeyNotebook", revision, notebookId, newNotebookId)
+}
+
+// NotebookAd is the associated data that binds a notebook ciphertext to
+// its identifier, format version and the revision it was sealed at.
+func NotebookAd(notebookId []byte, format uint32, revision uint64) []byte {
+	ad := []byte(NOTEBOOK_AD_CONTEXT)
+	ad = binary.BigEndian.AppendUint32(ad, format)
+	ad = binary.BigEndian.AppendUint64(ad, revision)
+	ad = binary.BigEndian.AppendUint32(ad, uint32(len(notebookId)))
+	return append(ad, notebookId...)
+}
+
+func writeMessage(operation string, revision uint64, fields ...[]byte) []byte {
+	msg := []byte(WRITE_KEY_CONTEXT)
+	msg = binary.BigEndian.AppendUint32(msg, uint32(len(operation)))
+	msg = append(msg, operation...)
+	msg = binary.BigEndian.AppendUint64(msg, revision)
+	for _, field := range fields {
+		msg = binary.BigEndian.AppendUint32(msg, uint32(len(field)))
+		msg = append(msg, field...)
+	}
+	return msg
+}
+
+func Encrypt(sk Subkey, pt []byte, ad []byte) (Ciphertext, error) {
 	if len(sk) != SUBKEY_L {
 		return Ciphertext{}, fmt.Errorf("encryption key must be %d bytes", SUBKEY_L)
 	}
@@ -94,11 +225,11 @@ func Encrypt(sk Subkey, pt []byte) (Ciphertext, error) {
 	if err != nil {
 		return Ciphertext{}, err
 	}
-	ct := cipher.Seal([]byte{}, nonce, pt, []byte{})
+	ct := cipher.Seal([]byte{}, nonce, pt, ad)
 	return Ciphertext{ct, nonce}, err
 }
 
-func Decrypt(sk Subkey, ct Ciphertext) ([]byte, error) {
+func Decrypt(sk Subkey, ct Ciphertext, ad []byte) ([]byte, error) {
 	if len(sk) != SUBKEY_L {
 		return []byte{}, fmt.Errorf("decryption key must be %d bytes", SUBKEY_L)
 	}
@@ -109,7 +240,7 @@ func Decrypt(sk Subkey, ct Ciphertext) ([]byte, error) {
 	if err != nil {
 		return []byte{}, err
 	}
-	pt, err := cipher.Open([]byte{}, ct.Nonce, ct.Data, []byte{})
+	pt, err := cipher.Open([]byte{}, ct.Nonce, ct.Data, ad)
 	if err != nil {
 		return []byte{}, err
 	}
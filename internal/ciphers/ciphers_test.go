@@ -0,0 +1,26 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package ciphers
+
+import "testing"
+
+func TestScryptMemoryCap(t *testing.T) {
+	if 128*SCRYPT_N*SCRYPT_R > KDF_MEMORY_MAX {
+		t.Fatal("the default scrypt parameters need more memory than is allowed")
+	}
+	// Each of these is within its own parameter's bounds but together
+	// they would need 4 GiB.
+	if _, err := DeriveKeyScrypt("", nil, 1<<22, 8, 1); err == nil {
+		t.Fatal("scrypt with N=2^22, r=8 was allowed")
+	}
+	if _, err := DeriveKeyScrypt("", nil, 1<<20, 32, 1); err == nil {
+		t.Fatal("scrypt with N=2^20, r=32 was allowed")
+	}
+	if _, err := DeriveKeyScrypt("", nil, 1<<10, 0, 1); err == nil {
+		t.Fatal("scrypt with r=0 was allowed")
+	}
+	if _, err := DeriveKeyScrypt("", nil, 1<<10, 8, 1); err != nil {
+		t.Fatal(err)
+	}
+}
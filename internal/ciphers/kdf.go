@@ -0,0 +1,95 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package ciphers
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const KDF_SCRYPT = "scrypt"
+const KDF_ARGON2ID = "argon2id"
+const ARGON2_TIME = 2
+const ARGON2_MEMORY = 1024 * 1024
+const ARGON2_THREADS = 4
+const ARGON2_TIME_MAX = 16
+const ARGON2_MEMORY_MAX = KDF_MEMORY_MAX / 1024
+const ARGON2_THREADS_MAX = 16
+const ARGON2_SALT = "qX7fRk2MzV9cLw4TnB6hYs3E"
+
+// Kdf describes how the user secret US is derived from a passphrase. The
+// passphrase is the only secret, so salts are fixed for each version:
+// the same passphrase must always lead to the same notebook.
+type Kdf struct {
+	Version   uint32
+	Algorithm string
+	Salt      []byte
+	N         int
+	R         int
+	P         int
+	Time      uint32
+	Memory    uint32
+	Threads   uint8
+}
+
+var KDF_V1 = Kdf{
+	Version:   1,
+	Algorithm: KDF_SCRYPT,
+	Salt:      []byte(SCRYPT_SALT),
+	N:         SCRYPT_N,
+	R:         SCRYPT_R,
+	P:         SCRYPT_P,
+}
+
+var KDF_V2 = Kdf{
+	Version:   2,
+	Algorithm: KDF_ARGON2ID,
+	Salt:      []byte(ARGON2_SALT),
+	Time:      ARGON2_TIME,
+	Memory:    ARGON2_MEMORY,
+	Threads:   ARGON2_THREADS,
+}
+
+var KDF_CURRENT = KDF_V2
+
+// KDFS lists every supported KDF, newest first. Notebooks are looked up
+// with each in turn when the version they were created with is unknown.
+var KDFS = []Kdf{KDF_V2, KDF_V1}
+
+// KdfVersion returns the KDF with the given version. Version 0 is what
+// notebooks created before versions were recorded carry, and maps to
+// the original scrypt parameters.
+func KdfVersion(version uint32) (Kdf, error) {
+	if version == 0 {
+		return KDF_V1, nil
+	}
+	for _, kdf := range KDFS {
+		if kdf.Version == version {
+			return kdf, nil
+		}
+	}
+	return Kdf{}, fmt.Errorf("unsupported key derivation version %d", version)
+}
+
+func (kdf Kdf) Derive(passphrase string) (Key, error) {
+	switch kdf.Algorithm {
+	case KDF_SCRYPT:
+		return DeriveKeyScrypt(passphrase, kdf.Salt, kdf.N, kdf.R, kdf.P)
+	case KDF_ARGON2ID:
+		return DeriveKeyArgon2id(passphrase, kdf.Salt, kdf.Time, kdf.Memory, kdf.Threads)
+	}
+	return []byte{}, fmt.Errorf("unsupported key derivation algorithm %q", kdf.Algorithm)
+}
+
+func DeriveKeyArgon2id(passphrase string, salt []byte, time uint32, memory uint32, threads uint8) (Key, error) {
+	if time > ARGON2_TIME_MAX || memory > ARGON2_MEMORY_MAX || threads > ARGON2_THREADS_MAX {
+		return []byte{}, errors.New("argon2id parameters are too large")
+	}
+	if time == 0 || threads == 0 {
+		return []byte{}, errors.New("argon2id parameters are too small")
+	}
+	return argon2.IDKey([]byte(passphrase), salt, time, memory, threads, SCRYPT_L), nil
+}
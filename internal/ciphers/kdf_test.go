@@ -0,0 +1,26 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package ciphers
+
+import "testing"
+
+func TestKdfMemoryCap(t *testing.T) {
+	for _, kdf := range KDFS {
+		if kdf.Algorithm == KDF_SCRYPT && 128*kdf.N*kdf.R > KDF_MEMORY_MAX {
+			t.Fatalf("KDF version %d needs more memory than is allowed", kdf.Version)
+		}
+		if kdf.Algorithm == KDF_ARGON2ID && kdf.Memory > ARGON2_MEMORY_MAX {
+			t.Fatalf("KDF version %d needs more memory than is allowed", kdf.Version)
+		}
+	}
+	if _, err := DeriveKeyArgon2id("", nil, 1, ARGON2_MEMORY_MAX+1, 1); err == nil {
+		t.Fatal("argon2id above the memory cap was allowed")
+	}
+	if _, err := DeriveKeyArgon2id("", nil, 0, 1024, 1); err == nil {
+		t.Fatal("argon2id with t=0 was allowed")
+	}
+	if _, err := DeriveKeyArgon2id("", nil, 1, 1024, 1); err != nil {
+		t.Fatal(err)
+	}
+}
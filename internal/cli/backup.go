@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/symbolicsoft/enclave/v2/internal/backup"
+	"github.com/symbolicsoft/enclave/v2/internal/client"
+	"github.com/symbolicsoft/enclave/v2/internal/notebook"
+	"github.com/symbolicsoft/enclave/v2/internal/setup"
+)
+
+func cmdBackup(args []string) int {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	output := fs.String("output", fmt.Sprintf("enclave-backup-%s%s", time.Now().Format("2006-01-02"), backup.BACKUP_EXTENSION), "backup file to write")
+	opts, args, code := parseArgsWith(fs, "backup [--output path]", args, 0)
+	if code != EXIT_OK {
+		return code
+	}
+	subkeys, nb, _, _, err := open(opts)
+	if err != nil {
+		return fail(err)
+	}
+	f, err := backup.Create(subkeys, nb)
+	if err != nil {
+		return fail(err)
+	}
+	err = backup.Write(*output, f)
+	if err != nil {
+		return fail(err)
+	}
+	if opts.json {
+		return printJson(map[string]string{"file": *output})
+	}
+	fmt.Printf("Backup written to %s.\n", *output)
+	return EXIT_OK
+}
+
+func cmdRestore(args []string) int {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	fromFile := fs.String("from-file", "", "backup file to restore")
+	force := fs.Bool("force", false, "replace the notebook if it already exists on the server")
+	opts, args, code := parseArgsWith(fs, "restore --from-file path [--force]", args, 0)
+	if code != EXIT_OK {
+		return code
+	}
+	if len(*fromFile) == 0 {
+		fs.Usage()
+		return EXIT_USAGE
+	}
+	f, err := backup.Read(*fromFile)
+	if err != nil {
+		return fail(err)
+	}
+	passphrase, err := secret(opts.passphraseFd, "ENCLAVE_PASSPHRASE")
+	if err != nil {
+		return fail(err)
+	}
+	if len(passphrase) == 0 {
+		passphrase = setup.Passphrase()
+	}
+	subkeys, nb, err := backup.Open(f, passphrase)
+	if err != nil {
+		return fail(err)
+	}
+	revision, err := notebook.Upload(subkeys, nb, *force)
+	if errors.Is(err, client.ErrConflict) {
+		fmt.Fprintln(os.Stderr, "error: this notebook already exists on the server: use --force to replace it")
+		return EXIT_CONFLICT
+	}
+	if err != nil {
+		return fail(err)
+	}
+	if opts.json {
+		return printJson(writeResult{Revision: revision})
+	}
+	fmt.Printf("Restored %d pages from %s.\n", len(nb.Pages), *fromFile)
+	return EXIT_OK
+}
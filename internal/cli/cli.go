@@ -0,0 +1,217 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/symbolicsoft/enclave/v2/internal/ciphers"
+	"github.com/symbolicsoft/enclave/v2/internal/client"
+	"github.com/symbolicsoft/enclave/v2/internal/config"
+	"github.com/symbolicsoft/enclave/v2/internal/notebook"
+	enclaveProto "github.com/symbolicsoft/enclave/v2/internal/proto"
+	"github.com/symbolicsoft/enclave/v2/internal/setup"
+)
+
+const EXIT_OK = 0
+const EXIT_ERR = 1
+const EXIT_USAGE = 2
+const EXIT_CONFLICT = 3
+const EXIT_OFFLINE = 4
+
+type command struct {
+	usage string
+	run   func(args []string) int
+}
+
+var commands = map[string]command{
+	"decoy":   {"decoy attach|rotate|detach  attach, replace or detach a decoy notebook", cmdDecoy},
+	"delete":  {"delete                      permanently delete the notebook from the server", cmdDelete},
+	"rekey":   {"rekey                       move the notebook to a newly generated passphrase", cmdRekey},
+	"migrate": {"migrate                     upgrade the notebook to the current key derivation", cmdMigrate},
+	"ls":      {"ls [--json]                 list pages", cmdLs},
+	"cat":     {"cat [--json] <page>         print a page", cmdCat},
+	"append":  {"append [--json] <page>      append standard input to a page", cmdAppend},
+	"new":     {"new [--json]                create a page from standard input", cmdNew},
+	"rm":      {"rm [--json] <page>          delete a page", cmdRm},
+	"export":  {"export [--format fmt]       export the notebook to md, json, tar or zip", cmdExport},
+	"import":  {"import [--json] <path>      import .md, .txt or notes app .json files", cmdImport},
+	"backup":  {"backup [--output path]      write an encrypted backup file", cmdBackup},
+	"restore": {"restore --from-file path    upload a backup file to the server", cmdRestore},
+	"sync":    {"sync [--json]               push changes saved locally while offline", cmdSync},
+}
+
+func Run(args []string) int {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+		Usage()
+		return EXIT_USAGE
+	}
+	return cmd.run(args[1:])
+}
+
+func Usage() {
+	usages := []string{}
+	for _, cmd := range commands {
+		usages = append(usages, "  enclave [flags] "+cmd.usage)
+	}
+	sort.Strings(usages)
+	fmt.Fprintf(os.Stderr, "Commands:\n%s\n", strings.Join(usages, "\n"))
+}
+
+func cmdDelete(args []string) int {
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "usage: enclave delete")
+		return EXIT_USAGE
+	}
+	subkeys, _, nb, revision, err := setup.Open()
+	if err != nil {
+		return fail(err)
+	}
+	if !setup.ConfirmDelete() {
+		fmt.Fprintln(os.Stderr, "Cancelled.")
+		return EXIT_ERR
+	}
+	err = notebook.Delete(subkeys, nb, revision)
+	if err != nil {
+		return fail(err)
+	}
+	config.Delete()
+	fmt.Println("Notebook deleted.")
+	return EXIT_OK
+}
+
+func cmdDecoy(args []string) int {
+	if len(args) != 1 || (args[0] != "attach" && args[0] != "rotate" && args[0] != "detach") {
+		fmt.Fprintln(os.Stderr, "usage: enclave decoy attach|rotate|detach")
+		return EXIT_USAGE
+	}
+	subkeys, _, nb, revision, err := setup.Open()
+	if err != nil {
+		return fail(err)
+	}
+	if args[0] == "detach" {
+		_, err = notebook.DetachDecoy(subkeys, nb, revision)
+		if err != nil {
+			return fail(err)
+		}
+		fmt.Println("Decoy notebook detached.")
+		return EXIT_OK
+	}
+	passphrase, _, err := notebook.CreateDecoy(subkeys, nb, revision, args[0] == "rotate")
+	if err != nil {
+		return fail(err)
+	}
+	fmt.Println("Decoy notebook attached. Decoy passphrase:")
+	fmt.Println(passphrase)
+	return EXIT_OK
+}
+
+func cmdRekey(args []string) int {
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "usage: enclave rekey")
+		return EXIT_USAGE
+	}
+	subkeys, pin, nb, revision, err := setup.Open()
+	if err != nil {
+		return fail(err)
+	}
+	pin, err = storedKeysPin(subkeys, pin)
+	if err != nil {
+		return fail(err)
+	}
+	passphrase, subkeys, _, err := notebook.Rekey(subkeys, nb, revision)
+	if err != nil {
+		return fail(err)
+	}
+	fmt.Println("Passphrase changed. New passphrase:")
+	fmt.Println(passphrase)
+	if len(pin) > 0 {
+		err = config.WriteKeys(subkeys, pin)
+		if err != nil {
+			return fail(err)
+		}
+	}
+	return EXIT_OK
+}
+
+func cmdMigrate(args []string) int {
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "usage: enclave migrate")
+		return EXIT_USAGE
+	}
+	passphrase := setup.Passphrase()
+	var nb *enclaveProto.Notebook
+	var revision uint64
+	subkeys, err := notebook.Open(passphrase, func(subkeys [3]ciphers.Subkey) error {
+		var err error
+		nb, revision, err = notebook.Restore(subkeys)
+		return err
+	})
+	if err != nil {
+		return fail(err)
+	}
+	if !notebook.NeedsMigration(nb) {
+		fmt.Println("Notebook already uses the current key derivation.")
+		return EXIT_OK
+	}
+	pin, err := storedKeysPin(subkeys, "")
+	if err != nil {
+		return fail(err)
+	}
+	subkeys, _, err = notebook.Migrate(subkeys, nb, revision, passphrase)
+	if err != nil {
+		return fail(err)
+	}
+	if len(pin) > 0 {
+		err = config.WriteKeys(subkeys, pin)
+		if err != nil {
+			return fail(err)
+		}
+	}
+	fmt.Println("Notebook upgraded to the current key derivation. Your passphrase is unchanged.")
+	return EXIT_OK
+}
+
+// storedKeysPin returns the PIN of the stored keys when they are the keys
+// of the notebook about to be moved, so that they can be rewritten with its
+// new keys, and asks for it unless it is already known. It returns an
+// empty PIN when there are no stored keys for this notebook.
+func storedKeysPin(subkeys [3]ciphers.Subkey, pin string) (string, error) {
+	if config.ConfigFileExists() != nil {
+		return "", nil
+	}
+	if len(pin) == 0 {
+		var err error
+		pin, err = setup.Unlock()
+		if err != nil {
+			return "", err
+		}
+	}
+	stored, err := config.ReadKeys(pin)
+	if err != nil {
+		return "", err
+	}
+	if !bytes.Equal(stored[0], subkeys[0]) {
+		return "", nil
+	}
+	return pin, nil
+}
+
+func fail(err error) int {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	switch {
+	case errors.Is(err, client.ErrConflict):
+		return EXIT_CONFLICT
+	case errors.Is(err, client.ErrOffline):
+		return EXIT_OFFLINE
+	}
+	return EXIT_ERR
+}
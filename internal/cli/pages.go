@@ -0,0 +1,394 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/symbolicsoft/enclave/v2/internal/ciphers"
+	"github.com/symbolicsoft/enclave/v2/internal/client"
+	"github.com/symbolicsoft/enclave/v2/internal/config"
+	"github.com/symbolicsoft/enclave/v2/internal/export"
+	"github.com/symbolicsoft/enclave/v2/internal/importer"
+	"github.com/symbolicsoft/enclave/v2/internal/notebook"
+	enclaveProto "github.com/symbolicsoft/enclave/v2/internal/proto"
+)
+
+type options struct {
+	json          bool
+	passphraseFd  int
+	pinFd         int
+	allowRollback bool
+}
+
+type pageInfo struct {
+	Index   int    `json:"index"`
+	Title   string `json:"title"`
+	ModDate int64  `json:"modDate"`
+	Body    string `json:"body,omitempty"`
+}
+
+type writeResult struct {
+	Index    int    `json:"index,omitempty"`
+	Revision uint64 `json:"revision"`
+	Pending  bool   `json:"pending"`
+}
+
+func cmdLs(args []string) int {
+	opts, args, code := parseArgs("ls", "ls [--json]", args, 0)
+	if code != EXIT_OK {
+		return code
+	}
+	nb, _, err := load(opts)
+	if err != nil {
+		return fail(err)
+	}
+	pages := []pageInfo{}
+	for i, page := range nb.Pages {
+		pages = append(pages, pageInfo{Index: i + 1, Title: notebook.PageTitle(page), ModDate: page.ModDate})
+	}
+	if opts.json {
+		return printJson(pages)
+	}
+	for _, page := range pages {
+		fmt.Printf("%d\t%s\t%s\n", page.Index, time.Unix(page.ModDate, 0).Format("2006-01-02 15:04"), page.Title)
+	}
+	return EXIT_OK
+}
+
+func cmdCat(args []string) int {
+	opts, args, code := parseArgs("cat", "cat [--json] <page>", args, 1)
+	if code != EXIT_OK {
+		return code
+	}
+	nb, _, err := load(opts)
+	if err != nil {
+		return fail(err)
+	}
+	index, err := pageIndex(nb, args[0])
+	if err != nil {
+		return fail(err)
+	}
+	page := nb.Pages[index]
+	if opts.json {
+		return printJson(pageInfo{Index: index + 1, Title: notebook.PageTitle(page), ModDate: page.ModDate, Body: page.Body})
+	}
+	fmt.Print(page.Body)
+	if !strings.HasSuffix(page.Body, "\n") {
+		fmt.Println()
+	}
+	return EXIT_OK
+}
+
+func cmdAppend(args []string) int {
+	opts, args, code := parseArgs("append", "append [--json] <page>", args, 1)
+	if code != EXIT_OK {
+		return code
+	}
+	input, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return fail(err)
+	}
+	subkeys, nb, revision, _, err := open(opts)
+	if err != nil {
+		return fail(err)
+	}
+	index, err := pageIndex(nb, args[0])
+	if err != nil {
+		return fail(err)
+	}
+	page := nb.Pages[index]
+	body := page.Body
+	if len(body) > 0 && !strings.HasSuffix(body, "\n") {
+		body += "\n"
+	}
+	body += string(input)
+	if len(body) > notebook.NOTEBOOK_PAGE_BYTES_MAX {
+		return fail(fmt.Errorf("page would exceed %d bytes", notebook.NOTEBOOK_PAGE_BYTES_MAX))
+	}
+	page.Body = body
+	page.ModDate = time.Now().Unix()
+	return save(opts, subkeys, nb, revision, index)
+}
+
+func cmdNew(args []string) int {
+	opts, args, code := parseArgs("new", "new [--json]", args, 0)
+	if code != EXIT_OK {
+		return code
+	}
+	input, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return fail(err)
+	}
+	if len(input) > notebook.NOTEBOOK_PAGE_BYTES_MAX {
+		return fail(fmt.Errorf("page would exceed %d bytes", notebook.NOTEBOOK_PAGE_BYTES_MAX))
+	}
+	subkeys, nb, revision, _, err := open(opts)
+	if err != nil {
+		return fail(err)
+	}
+	body := string(input)
+	if len(body) == 0 {
+		body = "New page\n\n"
+	}
+	newPage := &enclaveProto.Page{
+		Body:    body,
+		ModDate: time.Now().Unix(),
+	}
+	nb.Pages = append([]*enclaveProto.Page{newPage}, nb.Pages...)
+	return save(opts, subkeys, nb, revision, 0)
+}
+
+func cmdRm(args []string) int {
+	opts, args, code := parseArgs("rm", "rm [--json] <page>", args, 1)
+	if code != EXIT_OK {
+		return code
+	}
+	subkeys, nb, revision, _, err := open(opts)
+	if err != nil {
+		return fail(err)
+	}
+	index, err := pageIndex(nb, args[0])
+	if err != nil {
+		return fail(err)
+	}
+	nb.Pages = append(nb.Pages[:index], nb.Pages[index+1:]...)
+	return save(opts, subkeys, nb, revision, index)
+}
+
+func cmdExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", export.FORMAT_JSON, fmt.Sprintf("export format (%s)", strings.Join(export.FORMATS, ", ")))
+	output := fs.String("output", "-", "output file, or directory for md (\"-\" for standard output)")
+	opts, args, code := parseArgsWith(fs, "export [--format md|json|tar|zip] [--output path]", args, 0)
+	if code != EXIT_OK {
+		return code
+	}
+	if !export.IsFormat(*format) {
+		fmt.Fprintf(os.Stderr, "unknown export format %q\n", *format)
+		return EXIT_USAGE
+	}
+	if *format == export.FORMAT_MARKDOWN && *output == "-" {
+		fmt.Fprintln(os.Stderr, "md export needs an --output directory")
+		return EXIT_USAGE
+	}
+	nb, _, err := load(opts)
+	if err != nil {
+		return fail(err)
+	}
+	err = export.Export(nb, *format, *output)
+	if err != nil {
+		return fail(err)
+	}
+	return EXIT_OK
+}
+
+func cmdImport(args []string) int {
+	opts, args, code := parseArgs("import", "import [--json] <path>", args, 1)
+	if code != EXIT_OK {
+		return code
+	}
+	subkeys, nb, revision, _, err := open(opts)
+	if err != nil {
+		return fail(err)
+	}
+	report, err := importer.Import(nb, args[0])
+	if err != nil {
+		return fail(err)
+	}
+	code = EXIT_OK
+	if report.Imported > 0 {
+		code = save(options{}, subkeys, nb, revision, -1)
+		if code != EXIT_OK && code != EXIT_OFFLINE {
+			return code
+		}
+	}
+	if opts.json {
+		printJson(report)
+		return code
+	}
+	for _, skip := range report.Skipped {
+		fmt.Fprintf(os.Stderr, "skipped %s: %s\n", skip.Name, skip.Reason)
+	}
+	for _, name := range report.Truncated {
+		fmt.Fprintf(os.Stderr, "truncated %s to %d bytes\n", name, notebook.NOTEBOOK_PAGE_BYTES_MAX)
+	}
+	fmt.Printf("Imported %d pages.\n", report.Imported)
+	return code
+}
+
+func cmdSync(args []string) int {
+	opts, args, code := parseArgs("sync", "sync [--json]", args, 0)
+	if code != EXIT_OK {
+		return code
+	}
+	subkeys, nb, revision, pending, err := open(opts)
+	if err != nil {
+		return fail(err)
+	}
+	if !pending {
+		if opts.json {
+			return printJson(writeResult{Revision: revision})
+		}
+		return EXIT_OK
+	}
+	return save(opts, subkeys, nb, revision, -1)
+}
+
+func parseArgs(name string, usage string, args []string, nArgs int) (options, []string, int) {
+	return parseArgsWith(flag.NewFlagSet(name, flag.ContinueOnError), usage, args, nArgs)
+}
+
+func parseArgsWith(fs *flag.FlagSet, usage string, args []string, nArgs int) (options, []string, int) {
+	opts := options{}
+	fs.BoolVar(&opts.json, "json", false, "print JSON output")
+	fs.IntVar(&opts.passphraseFd, "passphrase-fd", -1, "read the passphrase from this file descriptor instead of ENCLAVE_PASSPHRASE")
+	fs.IntVar(&opts.pinFd, "pin-fd", -1, "read the stored keys' PIN from this file descriptor instead of ENCLAVE_PIN")
+	fs.BoolVar(&opts.allowRollback, "allow-rollback", false, "accept a notebook older than the latest revision seen on this device")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: enclave "+usage)
+		fs.PrintDefaults()
+	}
+	// Flags may come before or after positional arguments, as in
+	// "enclave cat 1 --json". Everything after "--" is positional.
+	positional := []string{}
+	for {
+		if err := fs.Parse(args); err != nil {
+			return opts, nil, EXIT_USAGE
+		}
+		rest := fs.Args()
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			positional = append(positional, rest...)
+			break
+		}
+		if len(rest) == 0 {
+			break
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+	if len(positional) != nArgs {
+		fs.Usage()
+		return opts, nil, EXIT_USAGE
+	}
+	return opts, positional, EXIT_OK
+}
+
+// open loads the notebook without prompting: with a passphrase if one is
+// given, otherwise with the stored keys and their PIN.
+func open(opts options) ([3]ciphers.Subkey, *enclaveProto.Notebook, uint64, bool, error) {
+	passphrase, err := secret(opts.passphraseFd, "ENCLAVE_PASSPHRASE")
+	if err != nil {
+		return [3]ciphers.Subkey{}, &enclaveProto.Notebook{}, 0, false, err
+	}
+	if len(passphrase) > 0 {
+		var nb *enclaveProto.Notebook
+		var revision uint64
+		var pending bool
+		subkeys, err := notebook.Open(passphrase, func(subkeys [3]ciphers.Subkey) error {
+			var err error
+			nb, revision, pending, err = loadSubkeys(opts, subkeys)
+			return err
+		})
+		if err != nil {
+			return [3]ciphers.Subkey{}, &enclaveProto.Notebook{}, 0, false, err
+		}
+		return subkeys, nb, revision, pending, nil
+	}
+	if config.ConfigFileExists() != nil {
+		return [3]ciphers.Subkey{}, &enclaveProto.Notebook{}, 0, false, errors.New("no passphrase given: set ENCLAVE_PASSPHRASE or use --passphrase-fd")
+	}
+	pin, err := secret(opts.pinFd, "ENCLAVE_PIN")
+	if err != nil {
+		return [3]ciphers.Subkey{}, &enclaveProto.Notebook{}, 0, false, err
+	}
+	encrypted, err := config.KeysAreEncrypted()
+	if err != nil {
+		return [3]ciphers.Subkey{}, &enclaveProto.Notebook{}, 0, false, err
+	}
+	if encrypted && len(pin) == 0 {
+		return [3]ciphers.Subkey{}, &enclaveProto.Notebook{}, 0, false, errors.New("stored keys are encrypted: set ENCLAVE_PIN or use --pin-fd")
+	}
+	subkeys, err := config.ReadKeys(pin)
+	if err != nil {
+		return [3]ciphers.Subkey{}, &enclaveProto.Notebook{}, 0, false, err
+	}
+	nb, revision, pending, err := loadSubkeys(opts, subkeys)
+	if err != nil {
+		return [3]ciphers.Subkey{}, &enclaveProto.Notebook{}, 0, false, err
+	}
+	return subkeys, nb, revision, pending, nil
+}
+
+func loadSubkeys(opts options, subkeys [3]ciphers.Subkey) (*enclaveProto.Notebook, uint64, bool, error) {
+	nb, revision, pending, _, err := notebook.Load(subkeys)
+	if errors.Is(err, notebook.ErrRollback) && opts.allowRollback {
+		notebook.ForgetRevision(subkeys)
+		nb, revision, pending, _, err = notebook.Load(subkeys)
+	}
+	return nb, revision, pending, err
+}
+
+func secret(fd int, env string) (string, error) {
+	if fd < 0 {
+		return strings.TrimSpace(os.Getenv(env)), nil
+	}
+	f := os.NewFile(uintptr(fd), fmt.Sprintf("fd%d", fd))
+	if f == nil {
+		return "", fmt.Errorf("invalid file descriptor %d", fd)
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+func load(opts options) (*enclaveProto.Notebook, uint64, error) {
+	_, nb, revision, _, err := open(opts)
+	return nb, revision, err
+}
+
+func save(opts options, subkeys [3]ciphers.Subkey, nb *enclaveProto.Notebook, revision uint64, index int) int {
+	revision, err := notebook.Save(subkeys, nb, revision)
+	pending := errors.Is(err, client.ErrOffline)
+	if err != nil && !pending {
+		return fail(err)
+	}
+	if opts.json {
+		printJson(writeResult{Index: index + 1, Revision: revision, Pending: pending})
+	}
+	if pending {
+		fmt.Fprintln(os.Stderr, "Server unreachable: change saved locally, run \"enclave sync\" once back online.")
+		return EXIT_OFFLINE
+	}
+	return EXIT_OK
+}
+
+func pageIndex(nb *enclaveProto.Notebook, arg string) (int, error) {
+	index, err := strconv.Atoi(arg)
+	if err != nil || index < 1 || index > len(nb.Pages) {
+		return 0, fmt.Errorf("no page %q: pages are numbered 1 to %d", arg, len(nb.Pages))
+	}
+	return index - 1, nil
+}
+
+func printJson(v any) int {
+	out, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return fail(err)
+	}
+	fmt.Println(string(out))
+	return EXIT_OK
+}
@@ -0,0 +1,26 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package cli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseArgsFlagsAnywhere(t *testing.T) {
+	for _, args := range []string{"--json 1", "1 --json", "--json -- 1", "1 --json --"} {
+		opts, positional, code := parseArgs("cat", "cat <page>", strings.Fields(args), 1)
+		if code != EXIT_OK || !opts.json || len(positional) != 1 || positional[0] != "1" {
+			t.Fatalf("%q: got %+v, %q, %d", args, opts, positional, code)
+		}
+	}
+	opts, positional, code := parseArgs("cat", "cat <page>", []string{"--", "--json"}, 1)
+	if code != EXIT_OK || opts.json || positional[0] != "--json" {
+		t.Fatalf("arguments after --: got %+v, %q, %d", opts, positional, code)
+	}
+	_, _, code = parseArgs("cat", "cat <page>", []string{"1", "2", "--json"}, 1)
+	if code != EXIT_USAGE {
+		t.Fatalf("extra argument: got %d, want %d", code, EXIT_USAGE)
+	}
+}
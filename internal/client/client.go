@@ -7,18 +7,25 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
-	"crypto/tls"
-	"crypto/x509"
 	"errors"
 	"time"
 
 	"github.com/symbolicsoft/enclave/v2/internal/ciphers"
 	enclaveProto "github.com/symbolicsoft/enclave/v2/internal/proto"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
 )
 
 const SERVER_GRPC = "enclave.sh:7070"
+
+// NOTEBOOK_BYTES_MAX is the largest encrypted notebook a server may store.
+// It is defined here rather than in the notebook package, which builds on
+// this one, so that the receive limit below is derived from it.
+const NOTEBOOK_BYTES_MAX = 8 * 1024 * 1024
+const GRPC_MESSAGE_OVERHEAD = 64 * 1024
+const GRPC_RECV_BYTES_MAX = NOTEBOOK_BYTES_MAX + GRPC_MESSAGE_OVERHEAD
 const SERVER_CERT = `-----BEGIN CERTIFICATE-----
 MIIBljCCATygAwIBAgIUCk9YeSAFCPRg0SQbi9leZHhVZOwwCgYIKoZIzj0EAwIw
 FTETMBEGA1UEAwwKZW5jbGF2ZS5zaDAeFw0yMzEyMjgxOTQ4NDZaFw0yODEyMjYx
@@ -31,12 +38,22 @@ A0gAMEUCIQCdR/CV7cE+JhpCTrZyG/OaGM9MnaIIhiTFn0lSViqlgAIgWyCqYYq4
 kQB4C/4Kwm4HmskeKBTx6z9ftCOr6qqpROM=
 -----END CERTIFICATE-----`
 
+var ErrConflict = errors.New("notebook was modified elsewhere since it was last loaded")
+var ErrNotFound = errors.New("notebook not found")
+var ErrNotRegistered = errors.New("notebook has no registered write key")
+var ErrOffline = errors.New("could not reach the Enclave server")
+var ErrUnauthorized = errors.New("notebook write not authorized: restore your notebook with its passphrase to renew your stored keys")
+
 func getClient() (*grpc.ClientConn, error) {
-	cp := x509.NewCertPool()
-	if !cp.AppendCertsFromPEM([]byte(SERVER_CERT)) {
-		return &grpc.ClientConn{}, errors.New("credentials: failed to append certificates")
+	tlsConfig, err := activeProfile.tlsConfig()
+	if err != nil {
+		return &grpc.ClientConn{}, err
 	}
-	return grpc.Dial(SERVER_GRPC, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{RootCAs: cp})))
+	return grpc.Dial(
+		activeProfile.Address,
+		grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(GRPC_RECV_BYTES_MAX)),
+	)
 }
 
 func PingPong() error {
@@ -68,52 +85,201 @@ func PingPong() error {
 	return nil
 }
 
-func PutNotebook(uskId ciphers.Subkey, decoyFor ciphers.Subkey, ct ciphers.Ciphertext) error {
+func PutNotebook(uskWa ciphers.Subkey, decoyFor ciphers.Subkey, sealed *enclaveProto.EncryptedNotebook) (uint64, error) {
 	enb := &enclaveProto.EncryptedNotebook{
-		NotebookId: uskId,
-		DecoyFor:   decoyFor,
-		DecoyFuse:  false,
-		Data:       ct.Data,
-		Nonce:      ct.Nonce,
+		NotebookId:     sealed.NotebookId,
+		DecoyFor:       decoyFor,
+		DecoyFuse:      false,
+		Data:           sealed.Data,
+		Nonce:          sealed.Nonce,
+		Revision:       sealed.Revision,
+		Format:         sealed.Format,
+		SealedRevision: sealed.SealedRevision,
+	}
+	if len(uskWa) > 0 {
+		msg := ciphers.PutNotebookMessage(enb.NotebookId, enb.DecoyFor, enb.Revision, enb.Nonce, enb.Data)
+		writeKey, signature, err := ciphers.SignWrite(uskWa, msg)
+		if err != nil {
+			return 0, err
+		}
+		enb.WriteKey = writeKey
+		enb.Signature = signature
 	}
 	conn, err := getClient()
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer conn.Close()
 	grpcClient := enclaveProto.NewEnclaveServiceClient(conn)
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
-	_, err = grpcClient.PutNotebook(ctx, enb)
+	res, err := grpcClient.PutNotebook(ctx, enb)
 	if err != nil {
-		return err
+		return 0, mapError(err)
 	}
-	return nil
+	return res.Revision, nil
 }
 
 func GetNotebook(uskId ciphers.Subkey) (*enclaveProto.EncryptedNotebook, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	return GetNotebookContext(ctx, uskId)
+}
+
+func GetNotebookContext(ctx context.Context, uskId ciphers.Subkey) (*enclaveProto.EncryptedNotebook, error) {
 	conn, err := getClient()
 	if err != nil {
 		return &enclaveProto.EncryptedNotebook{}, err
 	}
-	if err != nil {
-		return &enclaveProto.EncryptedNotebook{}, err
-	}
 	defer conn.Close()
 	grpcClient := enclaveProto.NewEnclaveServiceClient(conn)
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-	defer cancel()
 	enb, err := grpcClient.GetNotebook(ctx, &enclaveProto.NotebookId{
 		Id: uskId,
 	})
 	if err != nil {
-		return &enclaveProto.EncryptedNotebook{}, err
+		return &enclaveProto.EncryptedNotebook{}, mapError(err)
 	}
 	return &enclaveProto.EncryptedNotebook{
-		NotebookId: enb.NotebookId,
-		DecoyFor:   []byte{},
-		DecoyFuse:  false,
-		Data:       enb.Data,
-		Nonce:      enb.Nonce,
+		NotebookId:     enb.NotebookId,
+		DecoyFor:       []byte{},
+		DecoyFuse:      false,
+		Data:           enb.Data,
+		Nonce:          enb.Nonce,
+		Revision:       enb.Revision,
+		Format:         enb.Format,
+		SealedRevision: enb.SealedRevision,
+		WriteKey:       enb.WriteKey,
 	}, nil
 }
+
+func DeleteNotebook(uskId ciphers.Subkey, uskWa ciphers.Subkey, revision uint64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	return DeleteNotebookContext(ctx, uskId, uskWa, revision)
+}
+
+func DeleteNotebookContext(ctx context.Context, uskId ciphers.Subkey, uskWa ciphers.Subkey, revision uint64) error {
+	if len(uskWa) == 0 {
+		return ErrUnauthorized
+	}
+	_, signature, err := ciphers.SignWrite(uskWa, ciphers.DeleteNotebookMessage(uskId, revision))
+	if err != nil {
+		return err
+	}
+	conn, err := getClient()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	grpcClient := enclaveProto.NewEnclaveServiceClient(conn)
+	_, err = grpcClient.DeleteNotebook(ctx, &enclaveProto.DeleteNotebookRequest{
+		NotebookId: uskId,
+		Revision:   revision,
+		Signature:  signature,
+	})
+	return mapError(err)
+}
+
+func SetDecoy(subkeys [3]ciphers.Subkey, decoySubkeys [3]ciphers.Subkey, revision uint64, deletePrevious bool) (uint64, error) {
+	if len(subkeys[2]) == 0 {
+		return 0, ErrUnauthorized
+	}
+	msg := ciphers.SetDecoyMessage(subkeys[0], decoySubkeys[0], revision, deletePrevious)
+	_, signature, err := ciphers.SignWrite(subkeys[2], msg)
+	if err != nil {
+		return 0, err
+	}
+	req := &enclaveProto.SetDecoyRequest{
+		NotebookId:     subkeys[0],
+		DecoyId:        decoySubkeys[0],
+		Revision:       revision,
+		DeletePrevious: deletePrevious,
+		Signature:      signature,
+	}
+	if len(decoySubkeys[0]) > 0 {
+		_, req.DecoySignature, err = ciphers.SignWrite(decoySubkeys[2], msg)
+		if err != nil {
+			return 0, err
+		}
+	}
+	conn, err := getClient()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	grpcClient := enclaveProto.NewEnclaveServiceClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	res, err := grpcClient.SetDecoy(ctx, req)
+	if err != nil {
+		return 0, mapError(err)
+	}
+	return res.Revision, nil
+}
+
+func RekeyNotebook(subkeys [3]ciphers.Subkey, newSubkeys [3]ciphers.Subkey, revision uint64, sealed *enclaveProto.EncryptedNotebook) (uint64, error) {
+	if len(subkeys[2]) == 0 {
+		return 0, ErrUnauthorized
+	}
+	_, signature, err := ciphers.SignWrite(subkeys[2], ciphers.RekeyNotebookMessage(subkeys[0], newSubkeys[0], revision))
+	if err != nil {
+		return 0, err
+	}
+	nenb := &enclaveProto.EncryptedNotebook{
+		NotebookId:     newSubkeys[0],
+		DecoyFor:       []byte{},
+		DecoyFuse:      false,
+		Data:           sealed.Data,
+		Nonce:          sealed.Nonce,
+		Revision:       revision,
+		Format:         sealed.Format,
+		SealedRevision: sealed.SealedRevision,
+	}
+	msg := ciphers.PutNotebookMessage(nenb.NotebookId, nenb.DecoyFor, nenb.Revision, nenb.Nonce, nenb.Data)
+	nenb.WriteKey, nenb.Signature, err = ciphers.SignWrite(newSubkeys[2], msg)
+	if err != nil {
+		return 0, err
+	}
+	conn, err := getClient()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	grpcClient := enclaveProto.NewEnclaveServiceClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	res, err := grpcClient.RekeyNotebook(ctx, &enclaveProto.RekeyNotebookRequest{
+		NotebookId:  subkeys[0],
+		Revision:    revision,
+		Signature:   signature,
+		NewNotebook: nenb,
+	})
+	if err != nil {
+		return 0, mapError(err)
+	}
+	return res.Revision, nil
+}
+
+// mapError maps the status errors returned by the server to the errors of
+// this package.
+func mapError(err error) error {
+	if isOffline(err) {
+		return ErrOffline
+	}
+	switch status.Code(err) {
+	case codes.NotFound:
+		return ErrNotFound
+	case codes.FailedPrecondition:
+		return ErrNotRegistered
+	case codes.PermissionDenied:
+		return ErrUnauthorized
+	case codes.Aborted:
+		return ErrConflict
+	}
+	return err
+}
+
+func isOffline(err error) bool {
+	code := status.Code(err)
+	return code == codes.Unavailable || code == codes.DeadlineExceeded
+}
@@ -0,0 +1,155 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const PROFILE_DEFAULT = "default"
+
+type Profile struct {
+	Address  string `json:"address"`
+	CertFile string `json:"certFile"`
+	SpkiHash string `json:"spkiHash"`
+	cert     []byte
+}
+
+type ClientConfig struct {
+	Profile  string             `json:"profile"`
+	Profiles map[string]Profile `json:"profiles"`
+}
+
+var activeProfile = DefaultProfile()
+
+func DefaultProfile() Profile {
+	return Profile{
+		Address: SERVER_GRPC,
+		cert:    []byte(SERVER_CERT),
+	}
+}
+
+func SetProfile(p Profile) error {
+	if len(p.Address) == 0 {
+		return errors.New("server address must not be empty")
+	}
+	if len(p.CertFile) > 0 {
+		cert, err := os.ReadFile(p.CertFile)
+		if err != nil {
+			return err
+		}
+		p.cert = cert
+	}
+	if len(p.cert) == 0 && len(p.SpkiHash) == 0 {
+		return errors.New("server profile must pin a certificate or an SPKI hash")
+	}
+	if len(p.SpkiHash) > 0 {
+		if _, err := decodeSpkiHash(p.SpkiHash); err != nil {
+			return err
+		}
+	}
+	activeProfile = p
+	return nil
+}
+
+func LoadProfile(configFilePath string, name string) (Profile, error) {
+	configFileBytes, err := os.ReadFile(configFilePath)
+	if os.IsNotExist(err) {
+		if len(name) == 0 || name == PROFILE_DEFAULT {
+			return DefaultProfile(), nil
+		}
+		return Profile{}, fmt.Errorf("unknown server profile %q", name)
+	}
+	if err != nil {
+		return Profile{}, err
+	}
+	clientConfig := ClientConfig{}
+	err = json.Unmarshal(configFileBytes, &clientConfig)
+	if err != nil {
+		return Profile{}, fmt.Errorf("could not parse %s: %v", configFilePath, err)
+	}
+	if len(name) == 0 {
+		name = clientConfig.Profile
+	}
+	if len(name) == 0 {
+		name = PROFILE_DEFAULT
+	}
+	p, ok := clientConfig.Profiles[name]
+	if !ok {
+		if name == PROFILE_DEFAULT {
+			return DefaultProfile(), nil
+		}
+		return Profile{}, fmt.Errorf("unknown server profile %q", name)
+	}
+	return p, nil
+}
+
+func (p Profile) WithOverrides(address string, certFile string, spkiHash string) Profile {
+	if len(address) > 0 {
+		p.Address = address
+	}
+	if len(certFile) > 0 || len(spkiHash) > 0 {
+		p.CertFile = certFile
+		p.SpkiHash = spkiHash
+		p.cert = []byte{}
+	}
+	return p
+}
+
+func (p Profile) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+	if len(p.cert) > 0 {
+		cp := x509.NewCertPool()
+		if !cp.AppendCertsFromPEM(p.cert) {
+			return &tls.Config{}, errors.New("credentials: failed to append certificates")
+		}
+		tlsConfig.RootCAs = cp
+	} else {
+		// Trust is established by the SPKI pin alone.
+		tlsConfig.InsecureSkipVerify = true
+	}
+	if len(p.SpkiHash) > 0 {
+		spkiHash, err := decodeSpkiHash(p.SpkiHash)
+		if err != nil {
+			return &tls.Config{}, err
+		}
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errors.New("credentials: no server certificate")
+			}
+			cert, err := x509.ParseCertificate(rawCerts[0])
+			if err != nil {
+				return err
+			}
+			h := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			if !bytes.Equal(h[:], spkiHash) {
+				return errors.New("credentials: server public key does not match pinned SPKI hash")
+			}
+			return nil
+		}
+	}
+	return tlsConfig, nil
+}
+
+func decodeSpkiHash(spkiHash string) ([]byte, error) {
+	spkiHash = strings.TrimPrefix(spkiHash, "sha256/")
+	h, err := hex.DecodeString(spkiHash)
+	if err != nil {
+		h, err = base64.StdEncoding.DecodeString(spkiHash)
+	}
+	if err != nil || len(h) != sha256.Size {
+		return []byte{}, errors.New("SPKI hash must be a hex or base64 SHA-256 digest")
+	}
+	return h, nil
+}
@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+func newCert(t *testing.T) (tls.Certificate, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, cert.RawSubjectPublicKeyInfo
+}
+
+// handshake connects to a TLS server presenting cert with the TLS
+// configuration of p.
+func handshake(t *testing.T, cert tls.Certificate, p Profile) error {
+	t.Helper()
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	tlsConfig, err := p.tlsConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsConfig.ServerName = "localhost"
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", listener.Addr().String(), tlsConfig)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func TestSpkiPin(t *testing.T) {
+	cert, spki := newCert(t)
+	other, otherSpki := newCert(t)
+	h := sha256.Sum256(spki)
+	otherH := sha256.Sum256(otherSpki)
+	pinned := Profile{Address: "localhost", SpkiHash: hex.EncodeToString(h[:])}
+	if err := handshake(t, cert, pinned); err != nil {
+		t.Fatalf("matching pin: %v", err)
+	}
+	if err := handshake(t, other, pinned); err == nil {
+		t.Fatal("a server with another key was accepted")
+	}
+	wrong := Profile{Address: "localhost", SpkiHash: "sha256/" + hex.EncodeToString(otherH[:])}
+	if err := handshake(t, cert, wrong); err == nil {
+		t.Fatal("a mismatched pin was accepted")
+	}
+	// A pinned certificate is still verified when a pin is also set.
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: other.Certificate[0]})
+	both := Profile{Address: "localhost", SpkiHash: hex.EncodeToString(h[:]), cert: certPem}
+	if err := handshake(t, cert, both); err == nil {
+		t.Fatal("a server whose certificate is not the pinned one was accepted")
+	}
+	if err := SetProfile(Profile{Address: "localhost"}); err == nil {
+		t.Fatal("a profile without a certificate or pin was accepted")
+	}
+	if err := SetProfile(Profile{Address: "localhost", SpkiHash: "abcd"}); err == nil {
+		t.Fatal("a malformed pin was accepted")
+	}
+}
@@ -4,13 +4,23 @@
 package config
 
 import (
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
+
+	"github.com/symbolicsoft/enclave/v2/internal/ciphers"
 )
 
-func EnsurePath() string {
+const KEYFILE_HEADER = "enclave-keyfile"
+const KEYFILE_VERSION = 1
+const PIN_LENGTH_MIN = 4
+
+func EnsureDir() string {
 	configPath := ""
 	switch runtime.GOOS {
 	case "windows":
@@ -26,7 +36,15 @@ func EnsurePath() string {
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		os.MkdirAll(configPath, 0o700)
 	}
-	return filepath.Join(configPath, "keys")
+	return configPath
+}
+
+func EnsurePath() string {
+	return filepath.Join(EnsureDir(), "keys")
+}
+
+func ClientConfigPath() string {
+	return filepath.Join(EnsureDir(), "client.json")
 }
 
 func ConfigFileExists() error {
@@ -60,4 +78,136 @@ func Delete() {
 	if ConfigFileExists() == nil {
 		os.Remove(configFilePath)
 	}
+	os.Remove(KdfPath())
+}
+
+func KdfPath() string {
+	return filepath.Join(EnsureDir(), "kdf")
+}
+
+// ReadKdfVersion returns the KDF version that last opened a notebook with
+// a passphrase on this device.
+func ReadKdfVersion() (uint32, error) {
+	kdfFileBytes, err := os.ReadFile(KdfPath())
+	if err != nil {
+		return 0, err
+	}
+	version, err := strconv.ParseUint(strings.TrimSpace(string(kdfFileBytes)), 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint32(version), nil
+}
+
+func WriteKdfVersion(version uint32) error {
+	return os.WriteFile(KdfPath(), []byte(strconv.FormatUint(uint64(version), 10)), 0o600)
+}
+
+func KeysAreEncrypted() (bool, error) {
+	configFile, err := Read()
+	if err != nil {
+		return false, err
+	}
+	return strings.HasPrefix(configFile[0], KEYFILE_HEADER), nil
+}
+
+func ReadKeys(pin string) ([3]ciphers.Subkey, error) {
+	configFile, err := Read()
+	if err != nil {
+		return [3]ciphers.Subkey{}, err
+	}
+	if !strings.HasPrefix(configFile[0], KEYFILE_HEADER) {
+		return readLegacyKeys(configFile)
+	}
+	if configFile[0] != keyfileHeader() {
+		return [3]ciphers.Subkey{}, errors.New("unsupported config file version")
+	}
+	if len(configFile) < 4 {
+		return [3]ciphers.Subkey{}, errors.New("could not decode config file")
+	}
+	salt, errSalt := hex.DecodeString(configFile[1])
+	nonce, errNonce := hex.DecodeString(configFile[2])
+	data, errData := hex.DecodeString(configFile[3])
+	if (errSalt != nil) || (errNonce != nil) || (errData != nil) {
+		return [3]ciphers.Subkey{}, errors.New("could not decode config file")
+	}
+	cek, err := ciphers.DerivePinKey(pin, salt)
+	if err != nil {
+		return [3]ciphers.Subkey{}, err
+	}
+	pt, err := ciphers.Decrypt(ciphers.Subkey(cek), ciphers.Ciphertext{
+		Data:  data,
+		Nonce: nonce,
+	}, []byte{})
+	if err != nil {
+		return [3]ciphers.Subkey{}, errors.New("incorrect PIN")
+	}
+	switch len(pt) {
+	case ciphers.SUBKEY_L * 2:
+		// Keys stored before write authorization was introduced.
+		return [3]ciphers.Subkey{pt[:ciphers.SUBKEY_L], pt[ciphers.SUBKEY_L:], ciphers.Subkey{}}, nil
+	case ciphers.SUBKEY_L * 3:
+		return [3]ciphers.Subkey{
+			pt[:ciphers.SUBKEY_L],
+			pt[ciphers.SUBKEY_L : ciphers.SUBKEY_L*2],
+			pt[ciphers.SUBKEY_L*2:],
+		}, nil
+	}
+	return [3]ciphers.Subkey{}, errors.New("could not decode config file")
+}
+
+func WriteKeys(subkeys [3]ciphers.Subkey, pin string) error {
+	if len(pin) < PIN_LENGTH_MIN {
+		return fmt.Errorf("PIN must have at least %d characters", PIN_LENGTH_MIN)
+	}
+	salt, err := ciphers.GeneratePinSalt()
+	if err != nil {
+		return err
+	}
+	cek, err := ciphers.DerivePinKey(pin, salt)
+	if err != nil {
+		return err
+	}
+	pt := append(append(append([]byte{}, subkeys[0]...), subkeys[1]...), subkeys[2]...)
+	ct, err := ciphers.Encrypt(ciphers.Subkey(cek), pt, []byte{})
+	if err != nil {
+		return err
+	}
+	return Write([]string{
+		keyfileHeader(),
+		hex.EncodeToString(salt),
+		hex.EncodeToString(ct.Nonce),
+		hex.EncodeToString(ct.Data),
+	})
+}
+
+func MigrateKeys(pin string) error {
+	configFile, err := Read()
+	if err != nil {
+		return err
+	}
+	subkeys, err := readLegacyKeys(configFile)
+	if err != nil {
+		return err
+	}
+	return WriteKeys(subkeys, pin)
+}
+
+func readLegacyKeys(configFile []string) ([3]ciphers.Subkey, error) {
+	if len(configFile) < 2 {
+		return [3]ciphers.Subkey{}, errors.New("could not decode config file")
+	}
+	uskId, errId := hex.DecodeString(configFile[0])
+	uskEd, errEd := hex.DecodeString(configFile[1])
+	if (errId != nil) || (errEd != nil) {
+		return [3]ciphers.Subkey{}, errors.New("could not decode config file")
+	}
+	if (len(uskId) != ciphers.SUBKEY_L) || (len(uskEd) != ciphers.SUBKEY_L) {
+		return [3]ciphers.Subkey{}, errors.New("could not decode config file")
+	}
+	return [3]ciphers.Subkey{uskId, uskEd, ciphers.Subkey{}}, nil
+}
+
+func keyfileHeader() string {
+	return fmt.Sprintf("%s %d", KEYFILE_HEADER, KEYFILE_VERSION)
 }
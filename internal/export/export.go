@@ -0,0 +1,217 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package export
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/symbolicsoft/enclave/v2/internal/notebook"
+	enclaveProto "github.com/symbolicsoft/enclave/v2/internal/proto"
+)
+
+const FORMAT_MARKDOWN = "md"
+const FORMAT_JSON = "json"
+const FORMAT_TAR = "tar"
+const FORMAT_ZIP = "zip"
+const FILENAME_LENGTH_MAX = 64
+const JSON_FILENAME = "notebook.json"
+
+var FORMATS = []string{FORMAT_MARKDOWN, FORMAT_JSON, FORMAT_TAR, FORMAT_ZIP}
+
+type Document struct {
+	Pages []Page `json:"pages"`
+}
+
+type Page struct {
+	Title    string `json:"title"`
+	Filename string `json:"filename"`
+	ModDate  int64  `json:"modDate"`
+	Body     string `json:"body"`
+}
+
+// Export writes nb to path in the given format. Markdown is written as a
+// directory of files; the other formats are written to a single file, or to
+// standard output if path is "-".
+func Export(nb *enclaveProto.Notebook, format string, path string) error {
+	if format == FORMAT_MARKDOWN {
+		return WriteMarkdownDir(nb, path)
+	}
+	var w io.Writer = os.Stdout
+	if path != "-" {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	switch format {
+	case FORMAT_JSON:
+		return WriteJson(nb, w)
+	case FORMAT_TAR:
+		return WriteTar(nb, w)
+	case FORMAT_ZIP:
+		return WriteZip(nb, w)
+	}
+	return fmt.Errorf("unknown export format %q", format)
+}
+
+func IsFormat(format string) bool {
+	for _, f := range FORMATS {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+func Filenames(nb *enclaveProto.Notebook) []string {
+	filenames := make([]string, len(nb.Pages))
+	used := map[string]bool{}
+	// New pages are added at the top, so walk from the oldest page first to
+	// keep existing filenames stable when a page with the same title is added.
+	for i := len(nb.Pages) - 1; i >= 0; i-- {
+		base := slug(notebook.PageTitle(nb.Pages[i]))
+		filename := base + ".md"
+		for n := 2; used[filename]; n++ {
+			filename = fmt.Sprintf("%s-%d.md", base, n)
+		}
+		used[filename] = true
+		filenames[i] = filename
+	}
+	return filenames
+}
+
+func Json(nb *enclaveProto.Notebook) Document {
+	filenames := Filenames(nb)
+	doc := Document{Pages: []Page{}}
+	for i, page := range nb.Pages {
+		doc.Pages = append(doc.Pages, Page{
+			Title:    notebook.PageTitle(page),
+			Filename: filenames[i],
+			ModDate:  page.ModDate,
+			Body:     page.Body,
+		})
+	}
+	return doc
+}
+
+func WriteJson(nb *enclaveProto.Notebook, w io.Writer) error {
+	out, err := json.MarshalIndent(Json(nb), "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(out, '\n'))
+	return err
+}
+
+func WriteMarkdownDir(nb *enclaveProto.Notebook, dir string) error {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return err
+	}
+	for i, filename := range Filenames(nb) {
+		page := nb.Pages[i]
+		path := filepath.Join(dir, filename)
+		err = os.WriteFile(path, []byte(page.Body), 0o600)
+		if err != nil {
+			return err
+		}
+		modDate := time.Unix(page.ModDate, 0)
+		err = os.Chtimes(path, modDate, modDate)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func WriteTar(nb *enclaveProto.Notebook, w io.Writer) error {
+	tw := tar.NewWriter(w)
+	err := archive(nb, func(name string, modDate time.Time, data []byte) error {
+		err := tw.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0o600,
+			Size:    int64(len(data)),
+			ModTime: modDate,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+func WriteZip(nb *enclaveProto.Notebook, w io.Writer) error {
+	zw := zip.NewWriter(w)
+	err := archive(nb, func(name string, modDate time.Time, data []byte) error {
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     name,
+			Method:   zip.Deflate,
+			Modified: modDate,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = fw.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// archive calls add for every page as a Markdown file, followed by the JSON
+// document carrying the notebook's metadata.
+func archive(nb *enclaveProto.Notebook, add func(name string, modDate time.Time, data []byte) error) error {
+	for i, filename := range Filenames(nb) {
+		page := nb.Pages[i]
+		err := add(filename, time.Unix(page.ModDate, 0), []byte(page.Body))
+		if err != nil {
+			return err
+		}
+	}
+	doc, err := json.MarshalIndent(Json(nb), "", "\t")
+	if err != nil {
+		return err
+	}
+	return add(JSON_FILENAME, time.Now(), append(doc, '\n'))
+}
+
+func slug(title string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteRune('-')
+			dash = true
+		}
+		if b.Len() >= FILENAME_LENGTH_MAX {
+			break
+		}
+	}
+	s := strings.TrimSuffix(b.String(), "-")
+	if len(s) == 0 {
+		return "untitled"
+	}
+	return s
+}
@@ -0,0 +1,166 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package export_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/symbolicsoft/enclave/v2/internal/export"
+	"github.com/symbolicsoft/enclave/v2/internal/importer"
+	enclaveProto "github.com/symbolicsoft/enclave/v2/internal/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+func newNotebook(bodies ...string) *enclaveProto.Notebook {
+	nb := &enclaveProto.Notebook{Pages: []*enclaveProto.Page{}}
+	for i, body := range bodies {
+		// Newest first, as in the editor.
+		nb.Pages = append(nb.Pages, &enclaveProto.Page{
+			Body:    body,
+			ModDate: int64(1700000000 - i*60),
+		})
+	}
+	return nb
+}
+
+func TestFilenames(t *testing.T) {
+	long := strings.Repeat("a", 100)
+	nb := newNotebook(
+		"Notes\n\nnewest",
+		"Notes\n\nnewer",
+		"Notes\n\noldest",
+		"",
+		"  \n\nno title",
+		"Ça va? Très bien!",
+		long,
+	)
+	want := []string{
+		"notes-3.md",
+		"notes-2.md",
+		"notes.md",
+		"untitled-2.md",
+		"untitled.md",
+		"ça-va-très-bien.md",
+		strings.Repeat("a", export.FILENAME_LENGTH_MAX) + ".md",
+	}
+	got := export.Filenames(nb)
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("page %d: got %q, want %q", i, got[i], want[i])
+		}
+	}
+	// Adding a page with an existing title keeps the older filenames.
+	nb.Pages = append([]*enclaveProto.Page{{Body: "Notes\n\nnew"}}, nb.Pages...)
+	if got := export.Filenames(nb); got[0] != "notes-4.md" || got[3] != "notes.md" {
+		t.Fatalf("after adding a page: got %q", got)
+	}
+}
+
+// expectImported imports path into an empty notebook and checks that it
+// holds the pages of want.
+func expectImported(t *testing.T, path string, want *enclaveProto.Notebook) {
+	t.Helper()
+	nb := &enclaveProto.Notebook{Pages: []*enclaveProto.Page{}}
+	report, err := importer.Import(nb, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Imported != len(want.Pages) {
+		t.Fatalf("imported %d pages, want %d: %v", report.Imported, len(want.Pages), report)
+	}
+	if !proto.Equal(nb, &enclaveProto.Notebook{Pages: want.Pages}) {
+		t.Fatalf("got %v, want %v", nb, want)
+	}
+}
+
+func TestJsonRoundTrip(t *testing.T) {
+	nb := newNotebook("First\n\nbody", "Second\n\nÜnïcödé ✓", "First\n\nagain")
+	path := filepath.Join(t.TempDir(), "notebook.json")
+	if err := export.Export(nb, export.FORMAT_JSON, path); err != nil {
+		t.Fatal(err)
+	}
+	expectImported(t, path, nb)
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	nb := newNotebook("First\n\nbody", "Second\n\nÜnïcödé ✓", "First\n\nagain")
+	for _, format := range []string{export.FORMAT_TAR, export.FORMAT_ZIP} {
+		dir := t.TempDir()
+		var buf bytes.Buffer
+		var err error
+		if format == export.FORMAT_TAR {
+			err = export.WriteTar(nb, &buf)
+		} else {
+			err = export.WriteZip(nb, &buf)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := extract(t, format, buf.Bytes(), dir)
+		want := append(export.Filenames(nb), export.JSON_FILENAME)
+		sort.Strings(want)
+		if strings.Join(names, " ") != strings.Join(want, " ") {
+			t.Fatalf("%s: got files %q, want %q", format, names, want)
+		}
+		// Every page is in both a Markdown file and the JSON document, and
+		// is imported once.
+		expectImported(t, dir, nb)
+	}
+}
+
+func extract(t *testing.T, format string, data []byte, dir string) []string {
+	t.Helper()
+	names := []string{}
+	write := func(name string, modDate time.Time, r io.Reader) {
+		b, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, b, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modDate, modDate); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	if format == export.FORMAT_TAR {
+		tr := tar.NewReader(bytes.NewReader(data))
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			write(hdr.Name, hdr.ModTime, tr)
+		}
+	} else {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range zr.File {
+			r, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			write(f.Name, f.Modified, r)
+			r.Close()
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,246 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package importer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/symbolicsoft/enclave/v2/internal/export"
+	"github.com/symbolicsoft/enclave/v2/internal/notebook"
+	enclaveProto "github.com/symbolicsoft/enclave/v2/internal/proto"
+	"golang.org/x/crypto/chacha20poly1305"
+	"google.golang.org/protobuf/proto"
+)
+
+type Report struct {
+	Imported  int      `json:"imported"`
+	Skipped   []Skip   `json:"skipped"`
+	Truncated []string `json:"truncated"`
+}
+
+type Skip struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+type source struct {
+	name string
+	page *enclaveProto.Page
+}
+
+type jsonImport struct {
+	// Enclave JSON export.
+	Pages []export.Page `json:"pages"`
+	// Simplenote export.
+	ActiveNotes []simplenoteNote `json:"activeNotes"`
+	// Google Keep (Takeout) note.
+	Title                   string         `json:"title"`
+	TextContent             *string        `json:"textContent"`
+	ListContent             []keepListItem `json:"listContent"`
+	UserEditedTimestampUsec int64          `json:"userEditedTimestampUsec"`
+	IsTrashed               bool           `json:"isTrashed"`
+}
+
+type simplenoteNote struct {
+	Content      string `json:"content"`
+	LastModified string `json:"lastModified"`
+}
+
+type keepListItem struct {
+	Text      string `json:"text"`
+	IsChecked bool   `json:"isChecked"`
+}
+
+// Import reads pages from path, which is a directory of .md, .txt and .json
+// files or a single such file, and merges them into nb. Imported pages are
+// added at the top of the notebook, newest first.
+func Import(nb *enclaveProto.Notebook, path string) (Report, error) {
+	report := Report{Skipped: []Skip{}, Truncated: []string{}}
+	sources := []source{}
+	info, err := os.Stat(path)
+	if err != nil {
+		return report, err
+	}
+	if info.IsDir() {
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if strings.HasPrefix(d.Name(), ".") && p != path {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				return nil
+			}
+			sources = append(sources, readFile(p, &report)...)
+			return nil
+		})
+		if err != nil {
+			return report, err
+		}
+	} else {
+		sources = readFile(path, &report)
+	}
+	sort.SliceStable(sources, func(i, j int) bool {
+		return sources[i].page.ModDate > sources[j].page.ModDate
+	})
+	existing := map[string]bool{}
+	for _, page := range nb.Pages {
+		existing[page.Body] = true
+	}
+	imported := []*enclaveProto.Page{}
+	size := notebookSize(nb)
+	for _, src := range sources {
+		if len(strings.TrimSpace(src.page.Body)) == 0 {
+			report.Skipped = append(report.Skipped, Skip{src.name, "empty"})
+			continue
+		}
+		if len(src.page.Body) > notebook.NOTEBOOK_PAGE_BYTES_MAX {
+			src.page.Body = truncate(src.page.Body, notebook.NOTEBOOK_PAGE_BYTES_MAX)
+			report.Truncated = append(report.Truncated, src.name)
+		}
+		if existing[src.page.Body] {
+			report.Skipped = append(report.Skipped, Skip{src.name, "already in notebook"})
+			continue
+		}
+		pageSize := proto.Size(&enclaveProto.Notebook{Pages: []*enclaveProto.Page{src.page}})
+		if size+pageSize > notebook.NOTEBOOK_BYTES_MAX {
+			report.Skipped = append(report.Skipped, Skip{src.name, "notebook is full"})
+			continue
+		}
+		size += pageSize
+		existing[src.page.Body] = true
+		imported = append(imported, src.page)
+	}
+	nb.Pages = append(imported, nb.Pages...)
+	report.Imported = len(imported)
+	return report, nil
+}
+
+func readFile(path string, report *Report) []source {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".md" && ext != ".txt" && ext != ".json" {
+		report.Skipped = append(report.Skipped, Skip{path, "unsupported file type"})
+		return []source{}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		report.Skipped = append(report.Skipped, Skip{path, err.Error()})
+		return []source{}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		report.Skipped = append(report.Skipped, Skip{path, err.Error()})
+		return []source{}
+	}
+	if !utf8.Valid(data) {
+		report.Skipped = append(report.Skipped, Skip{path, "not valid UTF-8 text"})
+		return []source{}
+	}
+	if ext == ".json" {
+		sources, err := readJson(path, data)
+		if err != nil {
+			report.Skipped = append(report.Skipped, Skip{path, err.Error()})
+			return []source{}
+		}
+		return sources
+	}
+	body := strings.ReplaceAll(string(data), "\r\n", "\n")
+	if len(strings.TrimSpace(body)) == 0 {
+		report.Skipped = append(report.Skipped, Skip{path, "empty"})
+		return []source{}
+	}
+	if len(strings.TrimSpace(strings.Split(body, "\n")[0])) == 0 {
+		// Use the filename as the page title.
+		stem := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		body = stem + "\n\n" + strings.TrimLeft(body, "\n")
+	}
+	return []source{{path, &enclaveProto.Page{
+		Body:    body,
+		ModDate: info.ModTime().Unix(),
+	}}}
+}
+
+func readJson(path string, data []byte) ([]source, error) {
+	ji := jsonImport{}
+	err := json.Unmarshal(data, &ji)
+	if err != nil {
+		return []source{}, errors.New("could not decode JSON")
+	}
+	sources := []source{}
+	switch {
+	case ji.Pages != nil:
+		for i, page := range ji.Pages {
+			sources = append(sources, source{fmt.Sprintf("%s#%d", path, i+1), &enclaveProto.Page{
+				Body:    page.Body,
+				ModDate: page.ModDate,
+			}})
+		}
+	case ji.ActiveNotes != nil:
+		for i, note := range ji.ActiveNotes {
+			modDate := time.Now()
+			if t, err := time.Parse(time.RFC3339, note.LastModified); err == nil {
+				modDate = t
+			}
+			sources = append(sources, source{fmt.Sprintf("%s#%d", path, i+1), &enclaveProto.Page{
+				Body:    strings.ReplaceAll(note.Content, "\r\n", "\n"),
+				ModDate: modDate.Unix(),
+			}})
+		}
+	case ji.TextContent != nil || ji.ListContent != nil:
+		if ji.IsTrashed {
+			return []source{}, errors.New("note is in the trash")
+		}
+		lines := []string{}
+		if len(ji.Title) > 0 {
+			lines = append(lines, ji.Title, "")
+		}
+		if ji.TextContent != nil {
+			lines = append(lines, *ji.TextContent)
+		}
+		for _, item := range ji.ListContent {
+			if item.IsChecked {
+				lines = append(lines, "- [x] "+item.Text)
+			} else {
+				lines = append(lines, "- [ ] "+item.Text)
+			}
+		}
+		modDate := ji.UserEditedTimestampUsec / 1000000
+		if modDate == 0 {
+			modDate = time.Now().Unix()
+		}
+		sources = append(sources, source{path, &enclaveProto.Page{
+			Body:    strings.Join(lines, "\n"),
+			ModDate: modDate,
+		}})
+	default:
+		return []source{}, errors.New("unrecognized JSON notes format")
+	}
+	return sources, nil
+}
+
+// notebookSize estimates the size of nb once encrypted, before padding.
+func notebookSize(nb *enclaveProto.Notebook) int {
+	return proto.Size(nb) + notebook.NOTEBOOK_LENGTH_L + chacha20poly1305.Overhead
+}
+
+func truncate(s string, n int) string {
+	s = s[:n]
+	for len(s) > 0 && !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
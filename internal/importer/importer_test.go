@@ -0,0 +1,132 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/symbolicsoft/enclave/v2/internal/notebook"
+	enclaveProto "github.com/symbolicsoft/enclave/v2/internal/proto"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func expectPages(t *testing.T, nb *enclaveProto.Notebook, want ...*enclaveProto.Page) {
+	t.Helper()
+	if len(nb.Pages) != len(want) {
+		t.Fatalf("got %d pages, want %d: %v", len(nb.Pages), len(want), nb.Pages)
+	}
+	for i, page := range want {
+		if nb.Pages[i].Body != page.Body || nb.Pages[i].ModDate != page.ModDate {
+			t.Fatalf("page %d: got %v, want %v", i, nb.Pages[i], page)
+		}
+	}
+}
+
+func TestImportSimplenote(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"notes.json": `{
+		"activeNotes": [
+			{"content": "Older\r\n\r\nfirst note", "lastModified": "2023-01-01T00:00:00.000Z"},
+			{"content": "Newer\r\n\r\nsecond note", "lastModified": "2024-01-01T00:00:00.000Z"},
+			{"content": "  ", "lastModified": "2024-01-01T00:00:00.000Z"}
+		]
+	}`})
+	nb := &enclaveProto.Notebook{Pages: []*enclaveProto.Page{}}
+	report, err := Import(nb, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Imported != 2 || len(report.Skipped) != 1 || report.Skipped[0].Reason != "empty" {
+		t.Fatalf("got report %v", report)
+	}
+	expectPages(t, nb,
+		&enclaveProto.Page{Body: "Newer\n\nsecond note", ModDate: 1704067200},
+		&enclaveProto.Page{Body: "Older\n\nfirst note", ModDate: 1672531200},
+	)
+}
+
+func TestImportKeep(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"text.json": `{"title": "Groceries", "textContent": "milk", "userEditedTimestampUsec": 1700000000000000}`,
+		"list.json": `{"title": "Todo", "listContent": [
+			{"text": "write tests", "isChecked": true},
+			{"text": "ship", "isChecked": false}
+		], "userEditedTimestampUsec": 1600000000000000}`,
+		"trashed.json": `{"title": "Old", "textContent": "gone", "isTrashed": true}`,
+		"other.json":   `{"something": "else"}`,
+	})
+	nb := &enclaveProto.Notebook{Pages: []*enclaveProto.Page{}}
+	report, err := Import(nb, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reasons := map[string]string{}
+	for _, skip := range report.Skipped {
+		reasons[filepath.Base(skip.Name)] = skip.Reason
+	}
+	if report.Imported != 2 || reasons["trashed.json"] != "note is in the trash" || reasons["other.json"] != "unrecognized JSON notes format" {
+		t.Fatalf("got report %v", report)
+	}
+	expectPages(t, nb,
+		&enclaveProto.Page{Body: "Groceries\n\nmilk", ModDate: 1700000000},
+		&enclaveProto.Page{Body: "Todo\n\n- [x] write tests\n- [ ] ship", ModDate: 1600000000},
+	)
+}
+
+func TestImportSizeLimit(t *testing.T) {
+	nb := &enclaveProto.Notebook{Pages: []*enclaveProto.Page{{
+		Body: strings.Repeat("x", notebook.NOTEBOOK_BYTES_MAX-1024),
+	}}}
+	dir := writeFiles(t, map[string]string{
+		"big.md":   "Big\n\n" + strings.Repeat("y", 2048),
+		"small.md": "Small",
+	})
+	report, err := Import(nb, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Imported != 1 || len(report.Skipped) != 1 || report.Skipped[0].Reason != "notebook is full" {
+		t.Fatalf("got report %v", report)
+	}
+	if nb.Pages[0].Body != "Small" {
+		t.Fatalf("got first page %q, want %q", nb.Pages[0].Body, "Small")
+	}
+	if size := notebookSize(nb); size > notebook.NOTEBOOK_BYTES_MAX {
+		t.Fatalf("notebook size %d exceeds %d", size, notebook.NOTEBOOK_BYTES_MAX)
+	}
+}
+
+func TestImportTruncates(t *testing.T) {
+	// A multi-byte character straddles the page size limit.
+	body := "Long\n\n" + strings.Repeat("é", notebook.NOTEBOOK_PAGE_BYTES_MAX/2)
+	path := filepath.Join(writeFiles(t, map[string]string{"long.md": body}), "long.md")
+	nb := &enclaveProto.Notebook{Pages: []*enclaveProto.Page{}}
+	report, err := Import(nb, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Imported != 1 || len(report.Truncated) != 1 || report.Truncated[0] != path {
+		t.Fatalf("got report %v", report)
+	}
+	got := nb.Pages[0].Body
+	if len(got) > notebook.NOTEBOOK_PAGE_BYTES_MAX || len(got) < notebook.NOTEBOOK_PAGE_BYTES_MAX-1 {
+		t.Fatalf("got %d bytes, want at most %d", len(got), notebook.NOTEBOOK_PAGE_BYTES_MAX)
+	}
+	if !utf8.ValidString(got) || !strings.HasPrefix(body, got) {
+		t.Fatal("truncated page is not a valid prefix")
+	}
+}
@@ -4,23 +4,39 @@
 package notebook
 
 import (
-	"encoding/hex"
+	"bytes"
+	"encoding/binary"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
+	"github.com/symbolicsoft/enclave/v2/internal/cache"
 	"github.com/symbolicsoft/enclave/v2/internal/ciphers"
 	"github.com/symbolicsoft/enclave/v2/internal/client"
 	"github.com/symbolicsoft/enclave/v2/internal/config"
 	enclaveProto "github.com/symbolicsoft/enclave/v2/internal/proto"
+	"github.com/symbolicsoft/enclave/v2/internal/watermark"
+	"github.com/symbolicsoft/enclave/v2/internal/words"
+	"golang.org/x/crypto/chacha20poly1305"
 	"google.golang.org/protobuf/proto"
 )
 
 const NOTEBOOK_PAGE_BYTES_MAX = 64 * 1024
-const NOTEBOOK_BYTES_MAX = NOTEBOOK_PAGE_BYTES_MAX * 128
+const NOTEBOOK_BYTES_MAX = client.NOTEBOOK_BYTES_MAX
+const NOTEBOOK_FORMAT_LEGACY = 0
+const NOTEBOOK_FORMAT_BOUND = 1
+const NOTEBOOK_FORMAT_PADDED = 2
+const NOTEBOOK_FORMAT = NOTEBOOK_FORMAT_PADDED
+const NOTEBOOK_PAD_MIN = 16 * 1024
+const NOTEBOOK_LENGTH_L = 4
+
+var ErrRollback = errors.New("notebook rollback detected")
 
 func Create() *enclaveProto.Notebook {
 	nb := &enclaveProto.Notebook{
-		Pages: []*enclaveProto.Page{},
+		Pages:      []*enclaveProto.Page{},
+		KdfVersion: ciphers.KDF_CURRENT.Version,
 	}
 	nb.Pages = append(nb.Pages, &enclaveProto.Page{
 		Body:    "First page\n\nThis is an initial notebook page.",
@@ -33,23 +49,58 @@ func Create() *enclaveProto.Notebook {
 	return nb
 }
 
-func Encrypt(sk ciphers.Subkey, nb *enclaveProto.Notebook) (ciphers.Ciphertext, error) {
+func PageTitle(page *enclaveProto.Page) string {
+	return strings.Split(page.GetBody(), "\n")[0]
+}
+
+// Encrypt seals nb for the notebook identified by subkeys[0], to be
+// written on top of revision. The identifier, format and revision are
+// bound to the ciphertext as associated data.
+func Encrypt(subkeys [3]ciphers.Subkey, nb *enclaveProto.Notebook, revision uint64) (*enclaveProto.EncryptedNotebook, error) {
 	nbBytes, err := proto.Marshal(nb)
 	if err != nil {
-		return ciphers.Ciphertext{}, err
+		return &enclaveProto.EncryptedNotebook{}, err
 	}
-	ct, err := ciphers.Encrypt(sk, nbBytes)
+	ct, err := ciphers.Encrypt(subkeys[1], pad(nbBytes), ciphers.NotebookAd(subkeys[0], NOTEBOOK_FORMAT, revision))
 	if err != nil {
-		return ciphers.Ciphertext{}, err
+		return &enclaveProto.EncryptedNotebook{}, err
 	}
-	return ct, nil
+	return &enclaveProto.EncryptedNotebook{
+		NotebookId:     subkeys[0],
+		Data:           ct.Data,
+		Nonce:          ct.Nonce,
+		Revision:       revision,
+		Format:         NOTEBOOK_FORMAT,
+		SealedRevision: revision,
+	}, nil
 }
 
-func Decrypt(sk ciphers.Subkey, ct ciphers.Ciphertext) (*enclaveProto.Notebook, error) {
-	pt, err := ciphers.Decrypt(sk, ct)
+// Decrypt opens enb as the notebook identified by subkeys[0]. Notebooks
+// in the legacy format were sealed without associated data, and only
+// notebooks in the padded format carry padding.
+func Decrypt(subkeys [3]ciphers.Subkey, enb *enclaveProto.EncryptedNotebook) (*enclaveProto.Notebook, error) {
+	var ad []byte
+	switch enb.Format {
+	case NOTEBOOK_FORMAT_LEGACY:
+		ad = []byte{}
+	case NOTEBOOK_FORMAT_BOUND, NOTEBOOK_FORMAT_PADDED:
+		ad = ciphers.NotebookAd(subkeys[0], enb.Format, enb.SealedRevision)
+	default:
+		return &enclaveProto.Notebook{}, fmt.Errorf("unsupported notebook format %d", enb.Format)
+	}
+	pt, err := ciphers.Decrypt(subkeys[1], ciphers.Ciphertext{
+		Data:  enb.Data,
+		Nonce: enb.Nonce,
+	}, ad)
 	if err != nil {
 		return &enclaveProto.Notebook{}, err
 	}
+	if enb.Format == NOTEBOOK_FORMAT_PADDED {
+		pt, err = unpad(pt)
+		if err != nil {
+			return &enclaveProto.Notebook{}, err
+		}
+	}
 	nb := &enclaveProto.Notebook{}
 	err = proto.Unmarshal(pt, nb)
 	if err != nil {
@@ -58,35 +109,393 @@ func Decrypt(sk ciphers.Subkey, ct ciphers.Ciphertext) (*enclaveProto.Notebook,
 	return nb, nil
 }
 
-func RestoreFromConfig() ([2]ciphers.Subkey, *enclaveProto.Notebook, error) {
-	configFile, err := config.Read()
+// pad prefixes pt with its length and fills it with zeros so that its
+// ciphertext is exactly a power of two in size, and only reveals a coarse
+// size bucket. The largest bucket is NOTEBOOK_BYTES_MAX, and servers may
+// only lower their limit to a smaller bucket (see IsPadBucket), so padding
+// never pushes a notebook that fits over the limit.
+func pad(pt []byte) []byte {
+	size := NOTEBOOK_PAD_MIN
+	for size < len(pt)+NOTEBOOK_LENGTH_L+chacha20poly1305.Overhead {
+		size *= 2
+	}
+	size = max(min(size, NOTEBOOK_BYTES_MAX)-chacha20poly1305.Overhead, len(pt)+NOTEBOOK_LENGTH_L)
+	padded := make([]byte, size)
+	binary.BigEndian.PutUint32(padded, uint32(len(pt)))
+	copy(padded[NOTEBOOK_LENGTH_L:], pt)
+	return padded
+}
+
+// IsPadBucket reports whether size is the ciphertext size of one of the
+// buckets that notebooks are padded to.
+func IsPadBucket(size int) bool {
+	return size > 0 && PadBucket(size) == size
+}
+
+// PadBucket returns the ciphertext size of the largest bucket that fits in
+// size, or 0 if none does.
+func PadBucket(size int) int {
+	if size < NOTEBOOK_PAD_MIN {
+		return 0
+	}
+	bucket := NOTEBOOK_PAD_MIN
+	for bucket*2 <= min(size, NOTEBOOK_BYTES_MAX) {
+		bucket *= 2
+	}
+	return bucket
+}
+
+func unpad(padded []byte) ([]byte, error) {
+	if len(padded) < NOTEBOOK_LENGTH_L {
+		return []byte{}, errors.New("invalid notebook padding")
+	}
+	n := binary.BigEndian.Uint32(padded)
+	if uint64(n) > uint64(len(padded)-NOTEBOOK_LENGTH_L) {
+		return []byte{}, errors.New("invalid notebook padding")
+	}
+	return padded[NOTEBOOK_LENGTH_L : NOTEBOOK_LENGTH_L+n], nil
+}
+
+func Load(subkeys [3]ciphers.Subkey) (*enclaveProto.Notebook, uint64, bool, bool, error) {
+	// Cache errors are not fatal: the server copy is used instead.
+	nc, _ := cache.Read(subkeys)
+	if nc.Pending != nil {
+		nb, err := Decrypt(subkeys, nc.Pending)
+		if err == nil {
+			return nb, nc.Pending.Revision, true, false, nil
+		}
+	}
+	nb, revision, err := Restore(subkeys)
+	if errors.Is(err, client.ErrOffline) && nc.Synced != nil {
+		nb, err = Decrypt(subkeys, nc.Synced)
+		if err != nil {
+			return &enclaveProto.Notebook{}, 0, false, false, err
+		}
+		return nb, nc.Synced.Revision, false, true, nil
+	}
 	if err != nil {
-		return [2]ciphers.Subkey{}, &enclaveProto.Notebook{}, err
+		return &enclaveProto.Notebook{}, 0, false, false, err
 	}
-	uskId, errId := hex.DecodeString(configFile[0])
-	uskEd, errEd := hex.DecodeString(configFile[1])
-	if (errId != nil) || (errEd != nil) {
-		return [2]ciphers.Subkey{}, &enclaveProto.Notebook{}, errors.New("could not decode config file")
+	return nb, revision, false, false, nil
+}
+
+func Restore(subkeys [3]ciphers.Subkey) (*enclaveProto.Notebook, uint64, error) {
+	enb, err := client.GetNotebook(subkeys[0])
+	if err != nil {
+		return &enclaveProto.Notebook{}, 0, err
+	}
+	nb, err := Decrypt(subkeys, enb)
+	if err != nil {
+		return &enclaveProto.Notebook{}, 0, err
 	}
-	nb, err := Restore([2]ciphers.Subkey{uskId, uskEd})
+	err = checkRollback(subkeys, enb)
 	if err != nil {
-		return [2]ciphers.Subkey{}, &enclaveProto.Notebook{}, err
+		return &enclaveProto.Notebook{}, 0, err
 	}
-	return [2]ciphers.Subkey{uskId, uskEd}, nb, nil
+	cache.Write(subkeys, &enclaveProto.NotebookCache{Synced: enb})
+	if len(enb.WriteKey) == 0 && len(subkeys[2]) > 0 {
+		// Claim notebooks created before write authorization as soon as
+		// they are opened, rather than on their next save, to shorten the
+		// window in which anyone knowing USK-ID could claim them first.
+		revision, err := Save(subkeys, nb, enb.Revision)
+		if err == nil {
+			return nb, revision, nil
+		}
+	}
+	return nb, enb.Revision, nil
 }
 
-func Restore(subkeys [2]ciphers.Subkey) (*enclaveProto.Notebook, error) {
+// checkRollback compares the authenticated revision of a fetched notebook
+// with the highest one seen on this device, and raises the latter. If the
+// watermark is missing while the notebook is cached on this device, the
+// revision of the cached copy is used instead, so that deleting the
+// watermark does not turn the check off.
+func checkRollback(subkeys [3]ciphers.Subkey, enb *enclaveProto.EncryptedNotebook) error {
+	seen, marked, err := watermark.Read(subkeys)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRollback, err)
+	}
+	ok, where := marked, "was already seen on this device"
+	if !marked {
+		nc, err := cache.Read(subkeys)
+		if err == nil && nc.Synced != nil && nc.Synced.Format != NOTEBOOK_FORMAT_LEGACY {
+			seen, ok = nc.Synced.SealedRevision, true
+			where = "is cached on this device and its revision watermark is missing"
+		}
+	}
+	if ok && enb.Format == NOTEBOOK_FORMAT_LEGACY {
+		return fmt.Errorf("%w: the server sent a notebook in the legacy format, but revision %d %s", ErrRollback, seen, where)
+	}
+	if ok && enb.SealedRevision < seen {
+		return fmt.Errorf("%w: the server sent revision %d, but revision %d %s", ErrRollback, enb.SealedRevision, seen, where)
+	}
+	if enb.Format != NOTEBOOK_FORMAT_LEGACY && (!marked || enb.SealedRevision > seen) {
+		return watermark.Write(subkeys, enb.SealedRevision)
+	}
+	return nil
+}
+
+// ForgetRevision drops the highest revision of a notebook seen on this
+// device, and the cached copy it would otherwise fall back to, so that an
+// older revision from the server is accepted once. Unsynced changes are
+// kept.
+func ForgetRevision(subkeys [3]ciphers.Subkey) {
+	watermark.Delete(subkeys)
+	nc, err := cache.Read(subkeys)
+	if err == nil && nc.Synced != nil {
+		nc.Synced = nil
+		cache.Write(subkeys, nc)
+	}
+}
+
+func Save(subkeys [3]ciphers.Subkey, nb *enclaveProto.Notebook, revision uint64) (uint64, error) {
+	enb, err := Encrypt(subkeys, nb, revision)
+	if err != nil {
+		return 0, err
+	}
+	newRevision, err := client.PutNotebook(subkeys[2], []byte{}, enb)
+	if errors.Is(err, client.ErrOffline) {
+		if err := WritePending(subkeys, enb); err != nil {
+			return 0, err
+		}
+		return revision, client.ErrOffline
+	}
+	if err != nil {
+		return 0, err
+	}
+	enb.Revision = newRevision
+	cache.Write(subkeys, &enclaveProto.NotebookCache{Synced: enb})
+	watermark.Write(subkeys, enb.SealedRevision)
+	return newRevision, nil
+}
+
+// SavePending stores nb in the local cache only, to be pushed to the server
+// the next time the notebook is loaded.
+func SavePending(subkeys [3]ciphers.Subkey, nb *enclaveProto.Notebook, revision uint64) error {
+	enb, err := Encrypt(subkeys, nb, revision)
+	if err != nil {
+		return err
+	}
+	return WritePending(subkeys, enb)
+}
+
+// WritePending keeps a save pending locally, on top of the revision it was
+// based on, until it can be pushed to the server.
+func WritePending(subkeys [3]ciphers.Subkey, enb *enclaveProto.EncryptedNotebook) error {
+	nc, _ := cache.Read(subkeys)
+	nc.Pending = enb
+	return cache.Write(subkeys, nc)
+}
+
+// Upload stores nb on the server as a new notebook. If a notebook already
+// exists under the same keys, it is only replaced when force is set.
+func Upload(subkeys [3]ciphers.Subkey, nb *enclaveProto.Notebook, force bool) (uint64, error) {
+	revision, err := Save(subkeys, nb, 0)
+	if !errors.Is(err, client.ErrConflict) || !force {
+		return revision, err
+	}
 	enb, err := client.GetNotebook(subkeys[0])
 	if err != nil {
-		return &enclaveProto.Notebook{}, err
+		return 0, err
 	}
-	ct := ciphers.Ciphertext{
-		Data:  enb.Data,
-		Nonce: enb.Nonce,
+	return Save(subkeys, nb, enb.Revision)
+}
+
+func Delete(subkeys [3]ciphers.Subkey, nb *enclaveProto.Notebook, revision uint64) error {
+	err := client.DeleteNotebook(subkeys[0], subkeys[2], revision)
+	if errors.Is(err, client.ErrNotRegistered) {
+		// Notebooks created before write authorization need one
+		// signed save to register their write key first.
+		revision, err = Save(subkeys, nb, revision)
+		if err != nil {
+			return err
+		}
+		err = client.DeleteNotebook(subkeys[0], subkeys[2], revision)
 	}
-	nb, err := Decrypt(subkeys[1], ct)
 	if err != nil {
-		return &enclaveProto.Notebook{}, err
+		return err
 	}
-	return nb, nil
+	cache.Delete(subkeys)
+	watermark.Delete(subkeys)
+	return nil
+}
+
+func CreateDecoy(subkeys [3]ciphers.Subkey, nb *enclaveProto.Notebook, revision uint64, deletePrevious bool) (string, uint64, error) {
+	passphrase, decoySubkeys, err := generateKeys()
+	if err != nil {
+		return "", 0, err
+	}
+	_, err = Save(decoySubkeys, Create(), 0)
+	if err != nil {
+		return "", 0, err
+	}
+	revision, err = setDecoy(subkeys, decoySubkeys, nb, revision, deletePrevious)
+	if err != nil {
+		return "", 0, err
+	}
+	return passphrase, revision, nil
+}
+
+func DetachDecoy(subkeys [3]ciphers.Subkey, nb *enclaveProto.Notebook, revision uint64) (uint64, error) {
+	return setDecoy(subkeys, [3]ciphers.Subkey{}, nb, revision, false)
+}
+
+func setDecoy(subkeys [3]ciphers.Subkey, decoySubkeys [3]ciphers.Subkey, nb *enclaveProto.Notebook, revision uint64, deletePrevious bool) (uint64, error) {
+	newRevision, err := client.SetDecoy(subkeys, decoySubkeys, revision, deletePrevious)
+	if errors.Is(err, client.ErrNotRegistered) {
+		revision, err = Save(subkeys, nb, revision)
+		if err != nil {
+			return 0, err
+		}
+		newRevision, err = client.SetDecoy(subkeys, decoySubkeys, revision, deletePrevious)
+	}
+	if err != nil {
+		return 0, err
+	}
+	nc, err := cache.Read(subkeys)
+	if err == nil && nc.Synced != nil {
+		nc.Synced.Revision = newRevision
+		cache.Write(subkeys, nc)
+	}
+	return newRevision, nil
+}
+
+func Rekey(subkeys [3]ciphers.Subkey, nb *enclaveProto.Notebook, revision uint64) (string, [3]ciphers.Subkey, uint64, error) {
+	passphrase, newSubkeys, err := generateKeys()
+	if err != nil {
+		return "", [3]ciphers.Subkey{}, 0, err
+	}
+	newRevision, err := rekey(subkeys, newSubkeys, nb, revision)
+	if err != nil {
+		return "", [3]ciphers.Subkey{}, 0, err
+	}
+	return passphrase, newSubkeys, newRevision, nil
+}
+
+// Migrate moves a notebook whose keys were derived with an older KDF to
+// the keys that the current KDF derives from the same passphrase.
+func Migrate(subkeys [3]ciphers.Subkey, nb *enclaveProto.Notebook, revision uint64, passphrase string) ([3]ciphers.Subkey, uint64, error) {
+	kdf, err := ciphers.KdfVersion(nb.KdfVersion)
+	if err != nil {
+		return [3]ciphers.Subkey{}, 0, err
+	}
+	oldSubkeys, err := deriveSubkeys(kdf, passphrase)
+	if err != nil {
+		return [3]ciphers.Subkey{}, 0, err
+	}
+	if !bytes.Equal(oldSubkeys[0], subkeys[0]) {
+		return [3]ciphers.Subkey{}, 0, errors.New("passphrase does not match the notebook")
+	}
+	newSubkeys, err := deriveSubkeys(ciphers.KDF_CURRENT, passphrase)
+	if err != nil {
+		return [3]ciphers.Subkey{}, 0, err
+	}
+	newRevision, err := rekey(subkeys, newSubkeys, nb, revision)
+	if err != nil {
+		return [3]ciphers.Subkey{}, 0, err
+	}
+	config.WriteKdfVersion(ciphers.KDF_CURRENT.Version)
+	return newSubkeys, newRevision, nil
+}
+
+func NeedsMigration(nb *enclaveProto.Notebook) bool {
+	return nb.KdfVersion != ciphers.KDF_CURRENT.Version
+}
+
+// Open derives keys from passphrase with each supported KDF until open
+// succeeds with them or detects a rollback, starting with the KDF that
+// last succeeded on this device and otherwise newest first. If none do,
+// the keys and error of the current KDF are returned.
+func Open(passphrase string, open func(subkeys [3]ciphers.Subkey) error) ([3]ciphers.Subkey, error) {
+	var currentSubkeys [3]ciphers.Subkey
+	var currentErr error
+	for _, kdf := range KdfOrder() {
+		subkeys, err := deriveSubkeys(kdf, passphrase)
+		if err != nil {
+			return [3]ciphers.Subkey{}, err
+		}
+		err = open(subkeys)
+		if err == nil || errors.Is(err, ErrRollback) {
+			if err == nil {
+				config.WriteKdfVersion(kdf.Version)
+			}
+			return subkeys, err
+		}
+		if kdf.Version == ciphers.KDF_CURRENT.Version {
+			currentSubkeys, currentErr = subkeys, err
+		}
+	}
+	return currentSubkeys, currentErr
+}
+
+// KdfOrder lists the supported KDFs in the order Open tries them. Every
+// miss costs a key derivation and a notebook lookup that the server
+// delays on purpose, so the KDF recorded on this device goes first.
+func KdfOrder() []ciphers.Kdf {
+	version, err := config.ReadKdfVersion()
+	if err != nil {
+		return ciphers.KDFS
+	}
+	kdfs := []ciphers.Kdf{}
+	for _, kdf := range ciphers.KDFS {
+		if kdf.Version == version {
+			kdfs = append([]ciphers.Kdf{kdf}, kdfs...)
+		} else {
+			kdfs = append(kdfs, kdf)
+		}
+	}
+	return kdfs
+}
+
+// rekey moves nb to newSubkeys, recording that they were derived with
+// the current KDF.
+func rekey(subkeys [3]ciphers.Subkey, newSubkeys [3]ciphers.Subkey, nb *enclaveProto.Notebook, revision uint64) (uint64, error) {
+	moved := proto.Clone(nb).(*enclaveProto.Notebook)
+	moved.KdfVersion = ciphers.KDF_CURRENT.Version
+	enb, err := Encrypt(newSubkeys, moved, revision)
+	if err != nil {
+		return 0, err
+	}
+	newRevision, err := client.RekeyNotebook(subkeys, newSubkeys, revision, enb)
+	if errors.Is(err, client.ErrNotRegistered) {
+		revision, err = Save(subkeys, nb, revision)
+		if err != nil {
+			return 0, err
+		}
+		enb, err = Encrypt(newSubkeys, moved, revision)
+		if err != nil {
+			return 0, err
+		}
+		newRevision, err = client.RekeyNotebook(subkeys, newSubkeys, revision, enb)
+	}
+	if err != nil {
+		return 0, err
+	}
+	nb.KdfVersion = moved.KdfVersion
+	enb.Revision = newRevision
+	cache.Delete(subkeys)
+	cache.Write(newSubkeys, &enclaveProto.NotebookCache{Synced: enb})
+	watermark.Delete(subkeys)
+	watermark.Write(newSubkeys, enb.SealedRevision)
+	return newRevision, nil
+}
+
+func generateKeys() (string, [3]ciphers.Subkey, error) {
+	passphrase, err := words.GeneratePassphrase(ciphers.PASSPHRASE_WORDS)
+	if err != nil {
+		return "", [3]ciphers.Subkey{}, err
+	}
+	subkeys, err := deriveSubkeys(ciphers.KDF_CURRENT, passphrase)
+	if err != nil {
+		return "", [3]ciphers.Subkey{}, err
+	}
+	return passphrase, subkeys, nil
+}
+
+func deriveSubkeys(kdf ciphers.Kdf, passphrase string) ([3]ciphers.Subkey, error) {
+	userSecret, err := ciphers.DeriveKeyWith(kdf, passphrase)
+	if err != nil {
+		return [3]ciphers.Subkey{}, err
+	}
+	return ciphers.DeriveSubkeys(userSecret)
 }
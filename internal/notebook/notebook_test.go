@@ -0,0 +1,234 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package notebook
+
+import (
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/symbolicsoft/enclave/v2/internal/cache"
+	"github.com/symbolicsoft/enclave/v2/internal/ciphers"
+	enclaveProto "github.com/symbolicsoft/enclave/v2/internal/proto"
+	"github.com/symbolicsoft/enclave/v2/internal/watermark"
+	"golang.org/x/crypto/chacha20poly1305"
+	"google.golang.org/protobuf/proto"
+)
+
+func newSubkeys(t *testing.T) [3]ciphers.Subkey {
+	t.Helper()
+	k := make([]byte, ciphers.SCRYPT_L)
+	rand.Read(k)
+	subkeys, err := ciphers.DeriveSubkeys(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return subkeys
+}
+
+func expectNotebook(t *testing.T, subkeys [3]ciphers.Subkey, enb *enclaveProto.EncryptedNotebook, want *enclaveProto.Notebook) {
+	t.Helper()
+	nb, err := Decrypt(subkeys, enb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(nb, want) {
+		t.Fatalf("got %v, want %v", nb, want)
+	}
+}
+
+func TestEncryptBindsIdFormatAndRevision(t *testing.T) {
+	subkeys := newSubkeys(t)
+	nb := Create()
+	enb, err := Encrypt(subkeys, nb, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectNotebook(t, subkeys, enb, nb)
+	// Same encryption key, another notebook identifier.
+	swapped := [3]ciphers.Subkey{newSubkeys(t)[0], subkeys[1], subkeys[2]}
+	if _, err := Decrypt(swapped, enb); err == nil {
+		t.Fatal("decrypted under another notebook identifier")
+	}
+	for _, tamper := range []func(enb *enclaveProto.EncryptedNotebook){
+		func(enb *enclaveProto.EncryptedNotebook) { enb.Format = NOTEBOOK_FORMAT_BOUND },
+		func(enb *enclaveProto.EncryptedNotebook) { enb.Format = NOTEBOOK_FORMAT_LEGACY },
+		func(enb *enclaveProto.EncryptedNotebook) { enb.SealedRevision = 4 },
+		func(enb *enclaveProto.EncryptedNotebook) { enb.SealedRevision = 6 },
+	} {
+		tampered := proto.Clone(enb).(*enclaveProto.EncryptedNotebook)
+		tamper(tampered)
+		if _, err := Decrypt(subkeys, tampered); err == nil {
+			t.Fatalf("decrypted with format %d and revision %d", tampered.Format, tampered.SealedRevision)
+		}
+	}
+	// The server's revision is not authenticated, only the sealed one.
+	enb.Revision = 9
+	expectNotebook(t, subkeys, enb, nb)
+}
+
+func TestDecryptLegacyFormats(t *testing.T) {
+	subkeys := newSubkeys(t)
+	nb := Create()
+	pt, err := proto.Marshal(nb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct, err := ciphers.Encrypt(subkeys[1], pt, []byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectNotebook(t, subkeys, &enclaveProto.EncryptedNotebook{
+		NotebookId: subkeys[0],
+		Data:       ct.Data,
+		Nonce:      ct.Nonce,
+		Revision:   3,
+		Format:     NOTEBOOK_FORMAT_LEGACY,
+	}, nb)
+	ct, err = ciphers.Encrypt(subkeys[1], pt, ciphers.NotebookAd(subkeys[0], NOTEBOOK_FORMAT_BOUND, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectNotebook(t, subkeys, &enclaveProto.EncryptedNotebook{
+		NotebookId:     subkeys[0],
+		Data:           ct.Data,
+		Nonce:          ct.Nonce,
+		Revision:       3,
+		Format:         NOTEBOOK_FORMAT_BOUND,
+		SealedRevision: 3,
+	}, nb)
+	if _, err := Decrypt(subkeys, &enclaveProto.EncryptedNotebook{Format: NOTEBOOK_FORMAT + 1}); err == nil {
+		t.Fatal("decrypted an unknown format")
+	}
+}
+
+func sealed(t *testing.T, subkeys [3]ciphers.Subkey, revision uint64) *enclaveProto.EncryptedNotebook {
+	t.Helper()
+	enb, err := Encrypt(subkeys, Create(), revision)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return enb
+}
+
+func expectWatermark(t *testing.T, subkeys [3]ciphers.Subkey, want uint64) {
+	t.Helper()
+	seen, ok, err := watermark.Read(subkeys)
+	if err != nil || !ok || seen != want {
+		t.Fatalf("got watermark %d, %v, %v, want %d", seen, ok, err, want)
+	}
+}
+
+func expectRollback(t *testing.T, what string, err error) {
+	t.Helper()
+	if !errors.Is(err, ErrRollback) {
+		t.Fatalf("%s: got %v, want ErrRollback", what, err)
+	}
+}
+
+func TestCheckRollback(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	subkeys := newSubkeys(t)
+	if err := checkRollback(subkeys, sealed(t, subkeys, 5)); err != nil {
+		t.Fatal(err)
+	}
+	expectWatermark(t, subkeys, 5)
+	expectRollback(t, "older revision", checkRollback(subkeys, sealed(t, subkeys, 4)))
+	legacy := sealed(t, subkeys, 5)
+	legacy.Format = NOTEBOOK_FORMAT_LEGACY
+	expectRollback(t, "legacy format", checkRollback(subkeys, legacy))
+	if err := checkRollback(subkeys, sealed(t, subkeys, 5)); err != nil {
+		t.Fatalf("same revision: %v", err)
+	}
+	if err := checkRollback(subkeys, sealed(t, subkeys, 8)); err != nil {
+		t.Fatalf("newer revision: %v", err)
+	}
+	expectWatermark(t, subkeys, 8)
+	// Each notebook has its own watermark.
+	if err := checkRollback(newSubkeys(t), sealed(t, subkeys, 1)); err != nil {
+		t.Fatalf("other notebook: %v", err)
+	}
+}
+
+func TestForgetRevisionAllowsRollback(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	subkeys := newSubkeys(t)
+	checkRollback(subkeys, sealed(t, subkeys, 5))
+	cache.Write(subkeys, &enclaveProto.NotebookCache{Synced: sealed(t, subkeys, 5), Pending: sealed(t, subkeys, 5)})
+	expectRollback(t, "before forgetting", checkRollback(subkeys, sealed(t, subkeys, 3)))
+	ForgetRevision(subkeys)
+	if err := checkRollback(subkeys, sealed(t, subkeys, 3)); err != nil {
+		t.Fatalf("after forgetting: %v", err)
+	}
+	expectWatermark(t, subkeys, 3)
+	expectRollback(t, "forgetting only once", checkRollback(subkeys, sealed(t, subkeys, 2)))
+	nc, err := cache.Read(subkeys)
+	if err != nil || nc.Pending == nil {
+		t.Fatalf("unsynced changes were dropped: %v", err)
+	}
+}
+
+func TestTamperedWatermark(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	subkeys := newSubkeys(t)
+	checkRollback(subkeys, sealed(t, subkeys, 5))
+	paths, _ := filepath.Glob(filepath.Join(watermark.EnsureDir(), "*"))
+	if len(paths) != 1 {
+		t.Fatalf("got %d watermark files, want 1", len(paths))
+	}
+	watermarkFile, _ := os.ReadFile(paths[0])
+	watermarkFile[len(watermarkFile)-1] ^= 1
+	os.WriteFile(paths[0], watermarkFile, 0o600)
+	expectRollback(t, "tampered watermark", checkRollback(subkeys, sealed(t, subkeys, 5)))
+	// A watermark copied from another notebook does not authenticate.
+	other := newSubkeys(t)
+	checkRollback(other, sealed(t, other, 9))
+	otherPaths, _ := filepath.Glob(filepath.Join(watermark.EnsureDir(), "*"))
+	for _, path := range otherPaths {
+		if path != paths[0] {
+			watermarkFile, _ = os.ReadFile(path)
+		}
+	}
+	os.WriteFile(paths[0], watermarkFile, 0o600)
+	expectRollback(t, "watermark of another notebook", checkRollback(subkeys, sealed(t, subkeys, 5)))
+}
+
+func TestMissingWatermarkFallsBackToCache(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	subkeys := newSubkeys(t)
+	checkRollback(subkeys, sealed(t, subkeys, 5))
+	cache.Write(subkeys, &enclaveProto.NotebookCache{Synced: sealed(t, subkeys, 5)})
+	watermark.Delete(subkeys)
+	expectRollback(t, "missing watermark", checkRollback(subkeys, sealed(t, subkeys, 3)))
+	if err := checkRollback(subkeys, sealed(t, subkeys, 5)); err != nil {
+		t.Fatalf("cached revision: %v", err)
+	}
+	expectWatermark(t, subkeys, 5)
+}
+
+func TestPadFillsBuckets(t *testing.T) {
+	for _, n := range []int{0, 1, NOTEBOOK_PAD_MIN - 20, NOTEBOOK_PAD_MIN - 19, 100 * 1024, NOTEBOOK_BYTES_MAX - 20} {
+		pt := make([]byte, n)
+		size := len(pad(pt)) + chacha20poly1305.Overhead
+		if !IsPadBucket(size) {
+			t.Fatalf("%d bytes padded to %d, which is not a bucket", n, size)
+		}
+		// A server limit lowered to any bucket that fits the notebook
+		// unpadded also fits it padded.
+		for bucket := NOTEBOOK_PAD_MIN; bucket <= NOTEBOOK_BYTES_MAX; bucket *= 2 {
+			if n+NOTEBOOK_LENGTH_L+chacha20poly1305.Overhead <= bucket && size > bucket {
+				t.Fatalf("%d bytes padded to %d, over the %d byte limit", n, size, bucket)
+			}
+		}
+		unpadded, err := unpad(pad(pt))
+		if err != nil || len(unpadded) != n {
+			t.Fatalf("%d bytes unpadded to %d, %v", n, len(unpadded), err)
+		}
+	}
+	if n := NOTEBOOK_BYTES_MAX; len(pad(make([]byte, n))) != n+NOTEBOOK_LENGTH_L {
+		t.Fatal("notebook over the largest bucket was padded")
+	}
+}
@@ -83,7 +83,8 @@ type Notebook struct {
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Pages []*Page `protobuf:"bytes,1,rep,name=Pages,proto3" json:"Pages,omitempty"`
+	Pages      []*Page `protobuf:"bytes,1,rep,name=Pages,proto3" json:"Pages,omitempty"`
+	KdfVersion uint32  `protobuf:"varint,2,opt,name=KdfVersion,proto3" json:"KdfVersion,omitempty"`
 }
 
 func (x *Notebook) Reset() {
@@ -125,16 +126,28 @@ func (x *Notebook) GetPages() []*Page {
 	return nil
 }
 
+func (x *Notebook) GetKdfVersion() uint32 {
+	if x != nil {
+		return x.KdfVersion
+	}
+	return 0
+}
+
 type EncryptedNotebook struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	NotebookId []byte `protobuf:"bytes,1,opt,name=NotebookId,proto3" json:"NotebookId,omitempty"`
-	DecoyFor   []byte `protobuf:"bytes,2,opt,name=DecoyFor,proto3" json:"DecoyFor,omitempty"`
-	DecoyFuse  bool   `protobuf:"varint,3,opt,name=DecoyFuse,proto3" json:"DecoyFuse,omitempty"`
-	Data       []byte `protobuf:"bytes,4,opt,name=Data,proto3" json:"Data,omitempty"`
-	Nonce      []byte `protobuf:"bytes,5,opt,name=Nonce,proto3" json:"Nonce,omitempty"`
+	NotebookId     []byte `protobuf:"bytes,1,opt,name=NotebookId,proto3" json:"NotebookId,omitempty"`
+	DecoyFor       []byte `protobuf:"bytes,2,opt,name=DecoyFor,proto3" json:"DecoyFor,omitempty"`
+	DecoyFuse      bool   `protobuf:"varint,3,opt,name=DecoyFuse,proto3" json:"DecoyFuse,omitempty"`
+	Data           []byte `protobuf:"bytes,4,opt,name=Data,proto3" json:"Data,omitempty"`
+	Nonce          []byte `protobuf:"bytes,5,opt,name=Nonce,proto3" json:"Nonce,omitempty"`
+	Revision       uint64 `protobuf:"varint,6,opt,name=Revision,proto3" json:"Revision,omitempty"`
+	WriteKey       []byte `protobuf:"bytes,7,opt,name=WriteKey,proto3" json:"WriteKey,omitempty"`
+	Signature      []byte `protobuf:"bytes,8,opt,name=Signature,proto3" json:"Signature,omitempty"`
+	Format         uint32 `protobuf:"varint,9,opt,name=Format,proto3" json:"Format,omitempty"`
+	SealedRevision uint64 `protobuf:"varint,10,opt,name=SealedRevision,proto3" json:"SealedRevision,omitempty"`
 }
 
 func (x *EncryptedNotebook) Reset() {
@@ -204,6 +217,96 @@ func (x *EncryptedNotebook) GetNonce() []byte {
 	return nil
 }
 
+func (x *EncryptedNotebook) GetRevision() uint64 {
+	if x != nil {
+		return x.Revision
+	}
+	return 0
+}
+
+func (x *EncryptedNotebook) GetWriteKey() []byte {
+	if x != nil {
+		return x.WriteKey
+	}
+	return nil
+}
+
+func (x *EncryptedNotebook) GetSignature() []byte {
+	if x != nil {
+		return x.Signature
+	}
+	return nil
+}
+
+func (x *EncryptedNotebook) GetFormat() uint32 {
+	if x != nil {
+		return x.Format
+	}
+	return 0
+}
+
+func (x *EncryptedNotebook) GetSealedRevision() uint64 {
+	if x != nil {
+		return x.SealedRevision
+	}
+	return 0
+}
+
+type NotebookCache struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Synced  *EncryptedNotebook `protobuf:"bytes,1,opt,name=Synced,proto3" json:"Synced,omitempty"`
+	Pending *EncryptedNotebook `protobuf:"bytes,2,opt,name=Pending,proto3" json:"Pending,omitempty"`
+}
+
+func (x *NotebookCache) Reset() {
+	*x = NotebookCache{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_enclave_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *NotebookCache) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NotebookCache) ProtoMessage() {}
+
+func (x *NotebookCache) ProtoReflect() protoreflect.Message {
+	mi := &file_enclave_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NotebookCache.ProtoReflect.Descriptor instead.
+func (*NotebookCache) Descriptor() ([]byte, []int) {
+	return file_enclave_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *NotebookCache) GetSynced() *EncryptedNotebook {
+	if x != nil {
+		return x.Synced
+	}
+	return nil
+}
+
+func (x *NotebookCache) GetPending() *EncryptedNotebook {
+	if x != nil {
+		return x.Pending
+	}
+	return nil
+}
+
 type NotebookId struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -215,7 +318,7 @@ type NotebookId struct {
 func (x *NotebookId) Reset() {
 	*x = NotebookId{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_enclave_proto_msgTypes[3]
+		mi := &file_enclave_proto_msgTypes[4]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -228,7 +331,7 @@ func (x *NotebookId) String() string {
 func (*NotebookId) ProtoMessage() {}
 
 func (x *NotebookId) ProtoReflect() protoreflect.Message {
-	mi := &file_enclave_proto_msgTypes[3]
+	mi := &file_enclave_proto_msgTypes[4]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -241,7 +344,7 @@ func (x *NotebookId) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use NotebookId.ProtoReflect.Descriptor instead.
 func (*NotebookId) Descriptor() ([]byte, []int) {
-	return file_enclave_proto_rawDescGZIP(), []int{3}
+	return file_enclave_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *NotebookId) GetId() []byte {
@@ -262,7 +365,7 @@ type Ping struct {
 func (x *Ping) Reset() {
 	*x = Ping{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_enclave_proto_msgTypes[4]
+		mi := &file_enclave_proto_msgTypes[5]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -275,7 +378,7 @@ func (x *Ping) String() string {
 func (*Ping) ProtoMessage() {}
 
 func (x *Ping) ProtoReflect() protoreflect.Message {
-	mi := &file_enclave_proto_msgTypes[4]
+	mi := &file_enclave_proto_msgTypes[5]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -288,7 +391,7 @@ func (x *Ping) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Ping.ProtoReflect.Descriptor instead.
 func (*Ping) Descriptor() ([]byte, []int) {
-	return file_enclave_proto_rawDescGZIP(), []int{4}
+	return file_enclave_proto_rawDescGZIP(), []int{5}
 }
 
 func (x *Ping) GetMsg() []byte {
@@ -303,13 +406,14 @@ type PutNotebookResponse struct {
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	ResponseCode int32 `protobuf:"varint,1,opt,name=responseCode,proto3" json:"responseCode,omitempty"`
+	ResponseCode int32  `protobuf:"varint,1,opt,name=responseCode,proto3" json:"responseCode,omitempty"`
+	Revision     uint64 `protobuf:"varint,2,opt,name=Revision,proto3" json:"Revision,omitempty"`
 }
 
 func (x *PutNotebookResponse) Reset() {
 	*x = PutNotebookResponse{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_enclave_proto_msgTypes[5]
+		mi := &file_enclave_proto_msgTypes[6]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -322,7 +426,7 @@ func (x *PutNotebookResponse) String() string {
 func (*PutNotebookResponse) ProtoMessage() {}
 
 func (x *PutNotebookResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_enclave_proto_msgTypes[5]
+	mi := &file_enclave_proto_msgTypes[6]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -335,7 +439,7 @@ func (x *PutNotebookResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use PutNotebookResponse.ProtoReflect.Descriptor instead.
 func (*PutNotebookResponse) Descriptor() ([]byte, []int) {
-	return file_enclave_proto_rawDescGZIP(), []int{5}
+	return file_enclave_proto_rawDescGZIP(), []int{6}
 }
 
 func (x *PutNotebookResponse) GetResponseCode() int32 {
@@ -345,21 +449,32 @@ func (x *PutNotebookResponse) GetResponseCode() int32 {
 	return 0
 }
 
+func (x *PutNotebookResponse) GetRevision() uint64 {
+	if x != nil {
+		return x.Revision
+	}
+	return 0
+}
+
 type GetNotebookResponse struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	ResponseCode int32  `protobuf:"varint,1,opt,name=responseCode,proto3" json:"responseCode,omitempty"`
-	NotebookId   []byte `protobuf:"bytes,2,opt,name=NotebookId,proto3" json:"NotebookId,omitempty"`
-	Data         []byte `protobuf:"bytes,3,opt,name=Data,proto3" json:"Data,omitempty"`
-	Nonce        []byte `protobuf:"bytes,4,opt,name=Nonce,proto3" json:"Nonce,omitempty"`
+	ResponseCode   int32  `protobuf:"varint,1,opt,name=responseCode,proto3" json:"responseCode,omitempty"`
+	NotebookId     []byte `protobuf:"bytes,2,opt,name=NotebookId,proto3" json:"NotebookId,omitempty"`
+	Data           []byte `protobuf:"bytes,3,opt,name=Data,proto3" json:"Data,omitempty"`
+	Nonce          []byte `protobuf:"bytes,4,opt,name=Nonce,proto3" json:"Nonce,omitempty"`
+	Revision       uint64 `protobuf:"varint,5,opt,name=Revision,proto3" json:"Revision,omitempty"`
+	Format         uint32 `protobuf:"varint,6,opt,name=Format,proto3" json:"Format,omitempty"`
+	SealedRevision uint64 `protobuf:"varint,7,opt,name=SealedRevision,proto3" json:"SealedRevision,omitempty"`
+	WriteKey       []byte `protobuf:"bytes,8,opt,name=WriteKey,proto3" json:"WriteKey,omitempty"`
 }
 
 func (x *GetNotebookResponse) Reset() {
 	*x = GetNotebookResponse{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_enclave_proto_msgTypes[6]
+		mi := &file_enclave_proto_msgTypes[7]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -372,7 +487,7 @@ func (x *GetNotebookResponse) String() string {
 func (*GetNotebookResponse) ProtoMessage() {}
 
 func (x *GetNotebookResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_enclave_proto_msgTypes[6]
+	mi := &file_enclave_proto_msgTypes[7]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -385,7 +500,7 @@ func (x *GetNotebookResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GetNotebookResponse.ProtoReflect.Descriptor instead.
 func (*GetNotebookResponse) Descriptor() ([]byte, []int) {
-	return file_enclave_proto_rawDescGZIP(), []int{6}
+	return file_enclave_proto_rawDescGZIP(), []int{7}
 }
 
 func (x *GetNotebookResponse) GetResponseCode() int32 {
@@ -416,6 +531,412 @@ func (x *GetNotebookResponse) GetNonce() []byte {
 	return nil
 }
 
+func (x *GetNotebookResponse) GetRevision() uint64 {
+	if x != nil {
+		return x.Revision
+	}
+	return 0
+}
+
+func (x *GetNotebookResponse) GetFormat() uint32 {
+	if x != nil {
+		return x.Format
+	}
+	return 0
+}
+
+func (x *GetNotebookResponse) GetSealedRevision() uint64 {
+	if x != nil {
+		return x.SealedRevision
+	}
+	return 0
+}
+
+func (x *GetNotebookResponse) GetWriteKey() []byte {
+	if x != nil {
+		return x.WriteKey
+	}
+	return nil
+}
+
+type DeleteNotebookRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	NotebookId []byte `protobuf:"bytes,1,opt,name=NotebookId,proto3" json:"NotebookId,omitempty"`
+	Revision   uint64 `protobuf:"varint,2,opt,name=Revision,proto3" json:"Revision,omitempty"`
+	Signature  []byte `protobuf:"bytes,3,opt,name=Signature,proto3" json:"Signature,omitempty"`
+}
+
+func (x *DeleteNotebookRequest) Reset() {
+	*x = DeleteNotebookRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_enclave_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DeleteNotebookRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteNotebookRequest) ProtoMessage() {}
+
+func (x *DeleteNotebookRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_enclave_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteNotebookRequest.ProtoReflect.Descriptor instead.
+func (*DeleteNotebookRequest) Descriptor() ([]byte, []int) {
+	return file_enclave_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *DeleteNotebookRequest) GetNotebookId() []byte {
+	if x != nil {
+		return x.NotebookId
+	}
+	return nil
+}
+
+func (x *DeleteNotebookRequest) GetRevision() uint64 {
+	if x != nil {
+		return x.Revision
+	}
+	return 0
+}
+
+func (x *DeleteNotebookRequest) GetSignature() []byte {
+	if x != nil {
+		return x.Signature
+	}
+	return nil
+}
+
+type DeleteNotebookResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	ResponseCode int32 `protobuf:"varint,1,opt,name=responseCode,proto3" json:"responseCode,omitempty"`
+}
+
+func (x *DeleteNotebookResponse) Reset() {
+	*x = DeleteNotebookResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_enclave_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DeleteNotebookResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteNotebookResponse) ProtoMessage() {}
+
+func (x *DeleteNotebookResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_enclave_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteNotebookResponse.ProtoReflect.Descriptor instead.
+func (*DeleteNotebookResponse) Descriptor() ([]byte, []int) {
+	return file_enclave_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *DeleteNotebookResponse) GetResponseCode() int32 {
+	if x != nil {
+		return x.ResponseCode
+	}
+	return 0
+}
+
+type SetDecoyRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	NotebookId     []byte `protobuf:"bytes,1,opt,name=NotebookId,proto3" json:"NotebookId,omitempty"`
+	DecoyId        []byte `protobuf:"bytes,2,opt,name=DecoyId,proto3" json:"DecoyId,omitempty"`
+	Revision       uint64 `protobuf:"varint,3,opt,name=Revision,proto3" json:"Revision,omitempty"`
+	DeletePrevious bool   `protobuf:"varint,4,opt,name=DeletePrevious,proto3" json:"DeletePrevious,omitempty"`
+	Signature      []byte `protobuf:"bytes,5,opt,name=Signature,proto3" json:"Signature,omitempty"`
+	DecoySignature []byte `protobuf:"bytes,6,opt,name=DecoySignature,proto3" json:"DecoySignature,omitempty"`
+}
+
+func (x *SetDecoyRequest) Reset() {
+	*x = SetDecoyRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_enclave_proto_msgTypes[10]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SetDecoyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetDecoyRequest) ProtoMessage() {}
+
+func (x *SetDecoyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_enclave_proto_msgTypes[10]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetDecoyRequest.ProtoReflect.Descriptor instead.
+func (*SetDecoyRequest) Descriptor() ([]byte, []int) {
+	return file_enclave_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *SetDecoyRequest) GetNotebookId() []byte {
+	if x != nil {
+		return x.NotebookId
+	}
+	return nil
+}
+
+func (x *SetDecoyRequest) GetDecoyId() []byte {
+	if x != nil {
+		return x.DecoyId
+	}
+	return nil
+}
+
+func (x *SetDecoyRequest) GetRevision() uint64 {
+	if x != nil {
+		return x.Revision
+	}
+	return 0
+}
+
+func (x *SetDecoyRequest) GetDeletePrevious() bool {
+	if x != nil {
+		return x.DeletePrevious
+	}
+	return false
+}
+
+func (x *SetDecoyRequest) GetSignature() []byte {
+	if x != nil {
+		return x.Signature
+	}
+	return nil
+}
+
+func (x *SetDecoyRequest) GetDecoySignature() []byte {
+	if x != nil {
+		return x.DecoySignature
+	}
+	return nil
+}
+
+type SetDecoyResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	ResponseCode int32  `protobuf:"varint,1,opt,name=responseCode,proto3" json:"responseCode,omitempty"`
+	Revision     uint64 `protobuf:"varint,2,opt,name=Revision,proto3" json:"Revision,omitempty"`
+}
+
+func (x *SetDecoyResponse) Reset() {
+	*x = SetDecoyResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_enclave_proto_msgTypes[11]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SetDecoyResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetDecoyResponse) ProtoMessage() {}
+
+func (x *SetDecoyResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_enclave_proto_msgTypes[11]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetDecoyResponse.ProtoReflect.Descriptor instead.
+func (*SetDecoyResponse) Descriptor() ([]byte, []int) {
+	return file_enclave_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *SetDecoyResponse) GetResponseCode() int32 {
+	if x != nil {
+		return x.ResponseCode
+	}
+	return 0
+}
+
+func (x *SetDecoyResponse) GetRevision() uint64 {
+	if x != nil {
+		return x.Revision
+	}
+	return 0
+}
+
+type RekeyNotebookRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	NotebookId  []byte             `protobuf:"bytes,1,opt,name=NotebookId,proto3" json:"NotebookId,omitempty"`
+	Revision    uint64             `protobuf:"varint,2,opt,name=Revision,proto3" json:"Revision,omitempty"`
+	Signature   []byte             `protobuf:"bytes,3,opt,name=Signature,proto3" json:"Signature,omitempty"`
+	NewNotebook *EncryptedNotebook `protobuf:"bytes,4,opt,name=NewNotebook,proto3" json:"NewNotebook,omitempty"`
+}
+
+func (x *RekeyNotebookRequest) Reset() {
+	*x = RekeyNotebookRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_enclave_proto_msgTypes[12]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *RekeyNotebookRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RekeyNotebookRequest) ProtoMessage() {}
+
+func (x *RekeyNotebookRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_enclave_proto_msgTypes[12]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RekeyNotebookRequest.ProtoReflect.Descriptor instead.
+func (*RekeyNotebookRequest) Descriptor() ([]byte, []int) {
+	return file_enclave_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *RekeyNotebookRequest) GetNotebookId() []byte {
+	if x != nil {
+		return x.NotebookId
+	}
+	return nil
+}
+
+func (x *RekeyNotebookRequest) GetRevision() uint64 {
+	if x != nil {
+		return x.Revision
+	}
+	return 0
+}
+
+func (x *RekeyNotebookRequest) GetSignature() []byte {
+	if x != nil {
+		return x.Signature
+	}
+	return nil
+}
+
+func (x *RekeyNotebookRequest) GetNewNotebook() *EncryptedNotebook {
+	if x != nil {
+		return x.NewNotebook
+	}
+	return nil
+}
+
+type RekeyNotebookResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	ResponseCode int32  `protobuf:"varint,1,opt,name=responseCode,proto3" json:"responseCode,omitempty"`
+	Revision     uint64 `protobuf:"varint,2,opt,name=Revision,proto3" json:"Revision,omitempty"`
+}
+
+func (x *RekeyNotebookResponse) Reset() {
+	*x = RekeyNotebookResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_enclave_proto_msgTypes[13]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *RekeyNotebookResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RekeyNotebookResponse) ProtoMessage() {}
+
+func (x *RekeyNotebookResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_enclave_proto_msgTypes[13]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RekeyNotebookResponse.ProtoReflect.Descriptor instead.
+func (*RekeyNotebookResponse) Descriptor() ([]byte, []int) {
+	return file_enclave_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *RekeyNotebookResponse) GetResponseCode() int32 {
+	if x != nil {
+		return x.ResponseCode
+	}
+	return 0
+}
+
+func (x *RekeyNotebookResponse) GetRevision() uint64 {
+	if x != nil {
+		return x.Revision
+	}
+	return 0
+}
+
 var File_enclave_proto protoreflect.FileDescriptor
 
 var file_enclave_proto_rawDesc = []byte{
@@ -423,10 +944,12 @@ var file_enclave_proto_rawDesc = []byte{
 	0x05, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x34, 0x0a, 0x04, 0x50, 0x61, 0x67, 0x65, 0x12, 0x12,
 	0x0a, 0x04, 0x42, 0x6f, 0x64, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x42, 0x6f,
 	0x64, 0x79, 0x12, 0x18, 0x0a, 0x07, 0x4d, 0x6f, 0x64, 0x44, 0x61, 0x74, 0x65, 0x18, 0x02, 0x20,
-	0x01, 0x28, 0x03, 0x52, 0x07, 0x4d, 0x6f, 0x64, 0x44, 0x61, 0x74, 0x65, 0x22, 0x2d, 0x0a, 0x08,
+	0x01, 0x28, 0x03, 0x52, 0x07, 0x4d, 0x6f, 0x64, 0x44, 0x61, 0x74, 0x65, 0x22, 0x4d, 0x0a, 0x08,
 	0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b, 0x12, 0x21, 0x0a, 0x05, 0x50, 0x61, 0x67, 0x65,
 	0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e,
-	0x50, 0x61, 0x67, 0x65, 0x52, 0x05, 0x50, 0x61, 0x67, 0x65, 0x73, 0x22, 0x97, 0x01, 0x0a, 0x11,
+	0x50, 0x61, 0x67, 0x65, 0x52, 0x05, 0x50, 0x61, 0x67, 0x65, 0x73, 0x12, 0x1e, 0x0a, 0x0a, 0x4b,
+	0x64, 0x66, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52,
+	0x0a, 0x4b, 0x64, 0x66, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x22, 0xad, 0x02, 0x0a, 0x11,
 	0x45, 0x6e, 0x63, 0x72, 0x79, 0x70, 0x74, 0x65, 0x64, 0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f,
 	0x6b, 0x12, 0x1e, 0x0a, 0x0a, 0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b, 0x49, 0x64, 0x18,
 	0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0a, 0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b, 0x49,
@@ -436,36 +959,122 @@ var file_enclave_proto_rawDesc = []byte{
 	0x52, 0x09, 0x44, 0x65, 0x63, 0x6f, 0x79, 0x46, 0x75, 0x73, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x44,
 	0x61, 0x74, 0x61, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x44, 0x61, 0x74, 0x61, 0x12,
 	0x14, 0x0a, 0x05, 0x4e, 0x6f, 0x6e, 0x63, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x05,
-	0x4e, 0x6f, 0x6e, 0x63, 0x65, 0x22, 0x1c, 0x0a, 0x0a, 0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f,
-	0x6b, 0x49, 0x64, 0x12, 0x0e, 0x0a, 0x02, 0x49, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52,
-	0x02, 0x49, 0x64, 0x22, 0x18, 0x0a, 0x04, 0x50, 0x69, 0x6e, 0x67, 0x12, 0x10, 0x0a, 0x03, 0x4d,
-	0x73, 0x67, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x03, 0x4d, 0x73, 0x67, 0x22, 0x39, 0x0a,
-	0x13, 0x50, 0x75, 0x74, 0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b, 0x52, 0x65, 0x73, 0x70,
+	0x4e, 0x6f, 0x6e, 0x63, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x52, 0x65, 0x76, 0x69, 0x73, 0x69, 0x6f,
+	0x6e, 0x18, 0x06, 0x20, 0x01, 0x28, 0x04, 0x52, 0x08, 0x52, 0x65, 0x76, 0x69, 0x73, 0x69, 0x6f,
+	0x6e, 0x12, 0x1a, 0x0a, 0x08, 0x57, 0x72, 0x69, 0x74, 0x65, 0x4b, 0x65, 0x79, 0x18, 0x07, 0x20,
+	0x01, 0x28, 0x0c, 0x52, 0x08, 0x57, 0x72, 0x69, 0x74, 0x65, 0x4b, 0x65, 0x79, 0x12, 0x1c, 0x0a,
+	0x09, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x74, 0x75, 0x72, 0x65, 0x18, 0x08, 0x20, 0x01, 0x28, 0x0c,
+	0x52, 0x09, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x74, 0x75, 0x72, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x46,
+	0x6f, 0x72, 0x6d, 0x61, 0x74, 0x18, 0x09, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x46, 0x6f, 0x72,
+	0x6d, 0x61, 0x74, 0x12, 0x26, 0x0a, 0x0e, 0x53, 0x65, 0x61, 0x6c, 0x65, 0x64, 0x52, 0x65, 0x76,
+	0x69, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0e, 0x53, 0x65, 0x61,
+	0x6c, 0x65, 0x64, 0x52, 0x65, 0x76, 0x69, 0x73, 0x69, 0x6f, 0x6e, 0x22, 0x75, 0x0a, 0x0d, 0x4e,
+	0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b, 0x43, 0x61, 0x63, 0x68, 0x65, 0x12, 0x30, 0x0a, 0x06,
+	0x53, 0x79, 0x6e, 0x63, 0x65, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x18, 0x2e, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x45, 0x6e, 0x63, 0x72, 0x79, 0x70, 0x74, 0x65, 0x64, 0x4e, 0x6f,
+	0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b, 0x52, 0x06, 0x53, 0x79, 0x6e, 0x63, 0x65, 0x64, 0x12, 0x32,
+	0x0a, 0x07, 0x50, 0x65, 0x6e, 0x64, 0x69, 0x6e, 0x67, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x18, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x45, 0x6e, 0x63, 0x72, 0x79, 0x70, 0x74, 0x65,
+	0x64, 0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b, 0x52, 0x07, 0x50, 0x65, 0x6e, 0x64, 0x69,
+	0x6e, 0x67, 0x22, 0x1c, 0x0a, 0x0a, 0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b, 0x49, 0x64,
+	0x12, 0x0e, 0x0a, 0x02, 0x49, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x02, 0x49, 0x64,
+	0x22, 0x18, 0x0a, 0x04, 0x50, 0x69, 0x6e, 0x67, 0x12, 0x10, 0x0a, 0x03, 0x4d, 0x73, 0x67, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x03, 0x4d, 0x73, 0x67, 0x22, 0x55, 0x0a, 0x13, 0x50, 0x75,
+	0x74, 0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
+	0x65, 0x12, 0x22, 0x0a, 0x0c, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x43, 0x6f, 0x64,
+	0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0c, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
+	0x65, 0x43, 0x6f, 0x64, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x52, 0x65, 0x76, 0x69, 0x73, 0x69, 0x6f,
+	0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x08, 0x52, 0x65, 0x76, 0x69, 0x73, 0x69, 0x6f,
+	0x6e, 0x22, 0xfb, 0x01, 0x0a, 0x13, 0x47, 0x65, 0x74, 0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f,
+	0x6b, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x22, 0x0a, 0x0c, 0x72, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x43, 0x6f, 0x64, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52,
+	0x0c, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x43, 0x6f, 0x64, 0x65, 0x12, 0x1e, 0x0a,
+	0x0a, 0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b, 0x49, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x0c, 0x52, 0x0a, 0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b, 0x49, 0x64, 0x12, 0x12, 0x0a,
+	0x04, 0x44, 0x61, 0x74, 0x61, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x44, 0x61, 0x74,
+	0x61, 0x12, 0x14, 0x0a, 0x05, 0x4e, 0x6f, 0x6e, 0x63, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0c,
+	0x52, 0x05, 0x4e, 0x6f, 0x6e, 0x63, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x52, 0x65, 0x76, 0x69, 0x73,
+	0x69, 0x6f, 0x6e, 0x18, 0x05, 0x20, 0x01, 0x28, 0x04, 0x52, 0x08, 0x52, 0x65, 0x76, 0x69, 0x73,
+	0x69, 0x6f, 0x6e, 0x12, 0x16, 0x0a, 0x06, 0x46, 0x6f, 0x72, 0x6d, 0x61, 0x74, 0x18, 0x06, 0x20,
+	0x01, 0x28, 0x0d, 0x52, 0x06, 0x46, 0x6f, 0x72, 0x6d, 0x61, 0x74, 0x12, 0x26, 0x0a, 0x0e, 0x53,
+	0x65, 0x61, 0x6c, 0x65, 0x64, 0x52, 0x65, 0x76, 0x69, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x07, 0x20,
+	0x01, 0x28, 0x04, 0x52, 0x0e, 0x53, 0x65, 0x61, 0x6c, 0x65, 0x64, 0x52, 0x65, 0x76, 0x69, 0x73,
+	0x69, 0x6f, 0x6e, 0x12, 0x1a, 0x0a, 0x08, 0x57, 0x72, 0x69, 0x74, 0x65, 0x4b, 0x65, 0x79, 0x18,
+	0x08, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x08, 0x57, 0x72, 0x69, 0x74, 0x65, 0x4b, 0x65, 0x79, 0x22,
+	0x71, 0x0a, 0x15, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f,
+	0x6b, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1e, 0x0a, 0x0a, 0x4e, 0x6f, 0x74, 0x65,
+	0x62, 0x6f, 0x6f, 0x6b, 0x49, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0a, 0x4e, 0x6f,
+	0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b, 0x49, 0x64, 0x12, 0x1a, 0x0a, 0x08, 0x52, 0x65, 0x76, 0x69,
+	0x73, 0x69, 0x6f, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x08, 0x52, 0x65, 0x76, 0x69,
+	0x73, 0x69, 0x6f, 0x6e, 0x12, 0x1c, 0x0a, 0x09, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x74, 0x75, 0x72,
+	0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x09, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x74, 0x75,
+	0x72, 0x65, 0x22, 0x3c, 0x0a, 0x16, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x4e, 0x6f, 0x74, 0x65,
+	0x62, 0x6f, 0x6f, 0x6b, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x22, 0x0a, 0x0c,
+	0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x43, 0x6f, 0x64, 0x65, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x05, 0x52, 0x0c, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x43, 0x6f, 0x64, 0x65,
+	0x22, 0xd5, 0x01, 0x0a, 0x0f, 0x53, 0x65, 0x74, 0x44, 0x65, 0x63, 0x6f, 0x79, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x12, 0x1e, 0x0a, 0x0a, 0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b,
+	0x49, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0a, 0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f,
+	0x6f, 0x6b, 0x49, 0x64, 0x12, 0x18, 0x0a, 0x07, 0x44, 0x65, 0x63, 0x6f, 0x79, 0x49, 0x64, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x07, 0x44, 0x65, 0x63, 0x6f, 0x79, 0x49, 0x64, 0x12, 0x1a,
+	0x0a, 0x08, 0x52, 0x65, 0x76, 0x69, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28, 0x04,
+	0x52, 0x08, 0x52, 0x65, 0x76, 0x69, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x26, 0x0a, 0x0e, 0x44, 0x65,
+	0x6c, 0x65, 0x74, 0x65, 0x50, 0x72, 0x65, 0x76, 0x69, 0x6f, 0x75, 0x73, 0x18, 0x04, 0x20, 0x01,
+	0x28, 0x08, 0x52, 0x0e, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x50, 0x72, 0x65, 0x76, 0x69, 0x6f,
+	0x75, 0x73, 0x12, 0x1c, 0x0a, 0x09, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x74, 0x75, 0x72, 0x65, 0x18,
+	0x05, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x09, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x74, 0x75, 0x72, 0x65,
+	0x12, 0x26, 0x0a, 0x0e, 0x44, 0x65, 0x63, 0x6f, 0x79, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x74, 0x75,
+	0x72, 0x65, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0e, 0x44, 0x65, 0x63, 0x6f, 0x79, 0x53,
+	0x69, 0x67, 0x6e, 0x61, 0x74, 0x75, 0x72, 0x65, 0x22, 0x52, 0x0a, 0x10, 0x53, 0x65, 0x74, 0x44,
+	0x65, 0x63, 0x6f, 0x79, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x22, 0x0a, 0x0c,
+	0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x43, 0x6f, 0x64, 0x65, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x05, 0x52, 0x0c, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x43, 0x6f, 0x64, 0x65,
+	0x12, 0x1a, 0x0a, 0x08, 0x52, 0x65, 0x76, 0x69, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x04, 0x52, 0x08, 0x52, 0x65, 0x76, 0x69, 0x73, 0x69, 0x6f, 0x6e, 0x22, 0xac, 0x01, 0x0a,
+	0x14, 0x52, 0x65, 0x6b, 0x65, 0x79, 0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b, 0x52, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1e, 0x0a, 0x0a, 0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f,
+	0x6b, 0x49, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0a, 0x4e, 0x6f, 0x74, 0x65, 0x62,
+	0x6f, 0x6f, 0x6b, 0x49, 0x64, 0x12, 0x1a, 0x0a, 0x08, 0x52, 0x65, 0x76, 0x69, 0x73, 0x69, 0x6f,
+	0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x08, 0x52, 0x65, 0x76, 0x69, 0x73, 0x69, 0x6f,
+	0x6e, 0x12, 0x1c, 0x0a, 0x09, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x74, 0x75, 0x72, 0x65, 0x18, 0x03,
+	0x20, 0x01, 0x28, 0x0c, 0x52, 0x09, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x74, 0x75, 0x72, 0x65, 0x12,
+	0x3a, 0x0a, 0x0b, 0x4e, 0x65, 0x77, 0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b, 0x18, 0x04,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x18, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x45, 0x6e, 0x63,
+	0x72, 0x79, 0x70, 0x74, 0x65, 0x64, 0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b, 0x52, 0x0b,
+	0x4e, 0x65, 0x77, 0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b, 0x22, 0x57, 0x0a, 0x15, 0x52,
+	0x65, 0x6b, 0x65, 0x79, 0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b, 0x52, 0x65, 0x73, 0x70,
 	0x6f, 0x6e, 0x73, 0x65, 0x12, 0x22, 0x0a, 0x0c, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
 	0x43, 0x6f, 0x64, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0c, 0x72, 0x65, 0x73, 0x70,
-	0x6f, 0x6e, 0x73, 0x65, 0x43, 0x6f, 0x64, 0x65, 0x22, 0x83, 0x01, 0x0a, 0x13, 0x47, 0x65, 0x74,
-	0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
-	0x12, 0x22, 0x0a, 0x0c, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x43, 0x6f, 0x64, 0x65,
-	0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0c, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
-	0x43, 0x6f, 0x64, 0x65, 0x12, 0x1e, 0x0a, 0x0a, 0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b,
-	0x49, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0a, 0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f,
-	0x6f, 0x6b, 0x49, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x44, 0x61, 0x74, 0x61, 0x18, 0x03, 0x20, 0x01,
-	0x28, 0x0c, 0x52, 0x04, 0x44, 0x61, 0x74, 0x61, 0x12, 0x14, 0x0a, 0x05, 0x4e, 0x6f, 0x6e, 0x63,
-	0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x05, 0x4e, 0x6f, 0x6e, 0x63, 0x65, 0x32, 0xbf,
-	0x01, 0x0a, 0x0e, 0x45, 0x6e, 0x63, 0x6c, 0x61, 0x76, 0x65, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63,
-	0x65, 0x12, 0x26, 0x0a, 0x08, 0x50, 0x69, 0x6e, 0x67, 0x50, 0x6f, 0x6e, 0x67, 0x12, 0x0b, 0x2e,
-	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x50, 0x69, 0x6e, 0x67, 0x1a, 0x0b, 0x2e, 0x70, 0x72, 0x6f,
-	0x74, 0x6f, 0x2e, 0x50, 0x69, 0x6e, 0x67, 0x22, 0x00, 0x12, 0x45, 0x0a, 0x0b, 0x50, 0x75, 0x74,
-	0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b, 0x12, 0x18, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
-	0x2e, 0x45, 0x6e, 0x63, 0x72, 0x79, 0x70, 0x74, 0x65, 0x64, 0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f,
-	0x6f, 0x6b, 0x1a, 0x1a, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x50, 0x75, 0x74, 0x4e, 0x6f,
-	0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00,
-	0x12, 0x3e, 0x0a, 0x0b, 0x47, 0x65, 0x74, 0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b, 0x12,
-	0x11, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b,
-	0x49, 0x64, 0x1a, 0x1a, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x47, 0x65, 0x74, 0x4e, 0x6f,
-	0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00,
-	0x42, 0x09, 0x5a, 0x07, 0x2e, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x06, 0x70, 0x72, 0x6f,
-	0x74, 0x6f, 0x33,
+	0x6f, 0x6e, 0x73, 0x65, 0x43, 0x6f, 0x64, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x52, 0x65, 0x76, 0x69,
+	0x73, 0x69, 0x6f, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x08, 0x52, 0x65, 0x76, 0x69,
+	0x73, 0x69, 0x6f, 0x6e, 0x32, 0x9d, 0x03, 0x0a, 0x0e, 0x45, 0x6e, 0x63, 0x6c, 0x61, 0x76, 0x65,
+	0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x26, 0x0a, 0x08, 0x50, 0x69, 0x6e, 0x67, 0x50,
+	0x6f, 0x6e, 0x67, 0x12, 0x0b, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x50, 0x69, 0x6e, 0x67,
+	0x1a, 0x0b, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x50, 0x69, 0x6e, 0x67, 0x22, 0x00, 0x12,
+	0x45, 0x0a, 0x0b, 0x50, 0x75, 0x74, 0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b, 0x12, 0x18,
+	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x45, 0x6e, 0x63, 0x72, 0x79, 0x70, 0x74, 0x65, 0x64,
+	0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b, 0x1a, 0x1a, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x2e, 0x50, 0x75, 0x74, 0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x3e, 0x0a, 0x0b, 0x47, 0x65, 0x74, 0x4e, 0x6f, 0x74,
+	0x65, 0x62, 0x6f, 0x6f, 0x6b, 0x12, 0x11, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x4e, 0x6f,
+	0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b, 0x49, 0x64, 0x1a, 0x1a, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x2e, 0x47, 0x65, 0x74, 0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x4f, 0x0a, 0x0e, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65,
+	0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b, 0x12, 0x1c, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x2e, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1d, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x44,
+	0x65, 0x6c, 0x65, 0x74, 0x65, 0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b, 0x52, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x3d, 0x0a, 0x08, 0x53, 0x65, 0x74, 0x44, 0x65,
+	0x63, 0x6f, 0x79, 0x12, 0x16, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x53, 0x65, 0x74, 0x44,
+	0x65, 0x63, 0x6f, 0x79, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x17, 0x2e, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x2e, 0x53, 0x65, 0x74, 0x44, 0x65, 0x63, 0x6f, 0x79, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x4c, 0x0a, 0x0d, 0x52, 0x65, 0x6b, 0x65, 0x79, 0x4e,
+	0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b, 0x12, 0x1b, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e,
+	0x52, 0x65, 0x6b, 0x65, 0x79, 0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x1a, 0x1c, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x52, 0x65, 0x6b,
+	0x65, 0x79, 0x4e, 0x6f, 0x74, 0x65, 0x62, 0x6f, 0x6f, 0x6b, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e,
+	0x73, 0x65, 0x22, 0x00, 0x42, 0x09, 0x5a, 0x07, 0x2e, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62,
+	0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -480,29 +1089,45 @@ func file_enclave_proto_rawDescGZIP() []byte {
 	return file_enclave_proto_rawDescData
 }
 
-var file_enclave_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_enclave_proto_msgTypes = make([]protoimpl.MessageInfo, 14)
 var file_enclave_proto_goTypes = []interface{}{
-	(*Page)(nil),                // 0: proto.Page
-	(*Notebook)(nil),            // 1: proto.Notebook
-	(*EncryptedNotebook)(nil),   // 2: proto.EncryptedNotebook
-	(*NotebookId)(nil),          // 3: proto.NotebookId
-	(*Ping)(nil),                // 4: proto.Ping
-	(*PutNotebookResponse)(nil), // 5: proto.PutNotebookResponse
-	(*GetNotebookResponse)(nil), // 6: proto.GetNotebookResponse
+	(*Page)(nil),                   // 0: proto.Page
+	(*Notebook)(nil),               // 1: proto.Notebook
+	(*EncryptedNotebook)(nil),      // 2: proto.EncryptedNotebook
+	(*NotebookCache)(nil),          // 3: proto.NotebookCache
+	(*NotebookId)(nil),             // 4: proto.NotebookId
+	(*Ping)(nil),                   // 5: proto.Ping
+	(*PutNotebookResponse)(nil),    // 6: proto.PutNotebookResponse
+	(*GetNotebookResponse)(nil),    // 7: proto.GetNotebookResponse
+	(*DeleteNotebookRequest)(nil),  // 8: proto.DeleteNotebookRequest
+	(*DeleteNotebookResponse)(nil), // 9: proto.DeleteNotebookResponse
+	(*SetDecoyRequest)(nil),        // 10: proto.SetDecoyRequest
+	(*SetDecoyResponse)(nil),       // 11: proto.SetDecoyResponse
+	(*RekeyNotebookRequest)(nil),   // 12: proto.RekeyNotebookRequest
+	(*RekeyNotebookResponse)(nil),  // 13: proto.RekeyNotebookResponse
 }
 var file_enclave_proto_depIdxs = []int32{
-	0, // 0: proto.Notebook.Pages:type_name -> proto.Page
-	4, // 1: proto.EnclaveService.PingPong:input_type -> proto.Ping
-	2, // 2: proto.EnclaveService.PutNotebook:input_type -> proto.EncryptedNotebook
-	3, // 3: proto.EnclaveService.GetNotebook:input_type -> proto.NotebookId
-	4, // 4: proto.EnclaveService.PingPong:output_type -> proto.Ping
-	5, // 5: proto.EnclaveService.PutNotebook:output_type -> proto.PutNotebookResponse
-	6, // 6: proto.EnclaveService.GetNotebook:output_type -> proto.GetNotebookResponse
-	4, // [4:7] is the sub-list for method output_type
-	1, // [1:4] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+	0,  // 0: proto.Notebook.Pages:type_name -> proto.Page
+	2,  // 1: proto.NotebookCache.Synced:type_name -> proto.EncryptedNotebook
+	2,  // 2: proto.NotebookCache.Pending:type_name -> proto.EncryptedNotebook
+	2,  // 3: proto.RekeyNotebookRequest.NewNotebook:type_name -> proto.EncryptedNotebook
+	5,  // 4: proto.EnclaveService.PingPong:input_type -> proto.Ping
+	2,  // 5: proto.EnclaveService.PutNotebook:input_type -> proto.EncryptedNotebook
+	4,  // 6: proto.EnclaveService.GetNotebook:input_type -> proto.NotebookId
+	8,  // 7: proto.EnclaveService.DeleteNotebook:input_type -> proto.DeleteNotebookRequest
+	10, // 8: proto.EnclaveService.SetDecoy:input_type -> proto.SetDecoyRequest
+	12, // 9: proto.EnclaveService.RekeyNotebook:input_type -> proto.RekeyNotebookRequest
+	5,  // 10: proto.EnclaveService.PingPong:output_type -> proto.Ping
+	6,  // 11: proto.EnclaveService.PutNotebook:output_type -> proto.PutNotebookResponse
+	7,  // 12: proto.EnclaveService.GetNotebook:output_type -> proto.GetNotebookResponse
+	9,  // 13: proto.EnclaveService.DeleteNotebook:output_type -> proto.DeleteNotebookResponse
+	11, // 14: proto.EnclaveService.SetDecoy:output_type -> proto.SetDecoyResponse
+	13, // 15: proto.EnclaveService.RekeyNotebook:output_type -> proto.RekeyNotebookResponse
+	10, // [10:16] is the sub-list for method output_type
+	4,  // [4:10] is the sub-list for method input_type
+	4,  // [4:4] is the sub-list for extension type_name
+	4,  // [4:4] is the sub-list for extension extendee
+	0,  // [0:4] is the sub-list for field type_name
 }
 
 func init() { file_enclave_proto_init() }
@@ -548,7 +1173,7 @@ func file_enclave_proto_init() {
 			}
 		}
 		file_enclave_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*NotebookId); i {
+			switch v := v.(*NotebookCache); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -560,7 +1185,7 @@ func file_enclave_proto_init() {
 			}
 		}
 		file_enclave_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*Ping); i {
+			switch v := v.(*NotebookId); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -572,7 +1197,7 @@ func file_enclave_proto_init() {
 			}
 		}
 		file_enclave_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*PutNotebookResponse); i {
+			switch v := v.(*Ping); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -584,6 +1209,18 @@ func file_enclave_proto_init() {
 			}
 		}
 		file_enclave_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PutNotebookResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_enclave_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*GetNotebookResponse); i {
 			case 0:
 				return &v.state
@@ -595,6 +1232,78 @@ func file_enclave_proto_init() {
 				return nil
 			}
 		}
+		file_enclave_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DeleteNotebookRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_enclave_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DeleteNotebookResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_enclave_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SetDecoyRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_enclave_proto_msgTypes[11].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SetDecoyResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_enclave_proto_msgTypes[12].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RekeyNotebookRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_enclave_proto_msgTypes[13].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RekeyNotebookResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -602,7 +1311,7 @@ func file_enclave_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_enclave_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   7,
+			NumMessages:   14,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
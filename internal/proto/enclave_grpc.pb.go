@@ -22,9 +22,12 @@ import (
 const _ = grpc.SupportPackageIsVersion7
 
 const (
-	EnclaveService_PingPong_FullMethodName    = "/proto.EnclaveService/PingPong"
-	EnclaveService_PutNotebook_FullMethodName = "/proto.EnclaveService/PutNotebook"
-	EnclaveService_GetNotebook_FullMethodName = "/proto.EnclaveService/GetNotebook"
+	EnclaveService_PingPong_FullMethodName       = "/proto.EnclaveService/PingPong"
+	EnclaveService_PutNotebook_FullMethodName    = "/proto.EnclaveService/PutNotebook"
+	EnclaveService_GetNotebook_FullMethodName    = "/proto.EnclaveService/GetNotebook"
+	EnclaveService_DeleteNotebook_FullMethodName = "/proto.EnclaveService/DeleteNotebook"
+	EnclaveService_SetDecoy_FullMethodName       = "/proto.EnclaveService/SetDecoy"
+	EnclaveService_RekeyNotebook_FullMethodName  = "/proto.EnclaveService/RekeyNotebook"
 )
 
 // EnclaveServiceClient is the client API for EnclaveService service.
@@ -34,6 +37,9 @@ type EnclaveServiceClient interface {
 	PingPong(ctx context.Context, in *Ping, opts ...grpc.CallOption) (*Ping, error)
 	PutNotebook(ctx context.Context, in *EncryptedNotebook, opts ...grpc.CallOption) (*PutNotebookResponse, error)
 	GetNotebook(ctx context.Context, in *NotebookId, opts ...grpc.CallOption) (*GetNotebookResponse, error)
+	DeleteNotebook(ctx context.Context, in *DeleteNotebookRequest, opts ...grpc.CallOption) (*DeleteNotebookResponse, error)
+	SetDecoy(ctx context.Context, in *SetDecoyRequest, opts ...grpc.CallOption) (*SetDecoyResponse, error)
+	RekeyNotebook(ctx context.Context, in *RekeyNotebookRequest, opts ...grpc.CallOption) (*RekeyNotebookResponse, error)
 }
 
 type enclaveServiceClient struct {
@@ -71,6 +77,33 @@ func (c *enclaveServiceClient) GetNotebook(ctx context.Context, in *NotebookId,
 	return out, nil
 }
 
+func (c *enclaveServiceClient) DeleteNotebook(ctx context.Context, in *DeleteNotebookRequest, opts ...grpc.CallOption) (*DeleteNotebookResponse, error) {
+	out := new(DeleteNotebookResponse)
+	err := c.cc.Invoke(ctx, EnclaveService_DeleteNotebook_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *enclaveServiceClient) SetDecoy(ctx context.Context, in *SetDecoyRequest, opts ...grpc.CallOption) (*SetDecoyResponse, error) {
+	out := new(SetDecoyResponse)
+	err := c.cc.Invoke(ctx, EnclaveService_SetDecoy_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *enclaveServiceClient) RekeyNotebook(ctx context.Context, in *RekeyNotebookRequest, opts ...grpc.CallOption) (*RekeyNotebookResponse, error) {
+	out := new(RekeyNotebookResponse)
+	err := c.cc.Invoke(ctx, EnclaveService_RekeyNotebook_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // EnclaveServiceServer is the server API for EnclaveService service.
 // All implementations must embed UnimplementedEnclaveServiceServer
 // for forward compatibility
@@ -78,6 +111,9 @@ type EnclaveServiceServer interface {
 	PingPong(context.Context, *Ping) (*Ping, error)
 	PutNotebook(context.Context, *EncryptedNotebook) (*PutNotebookResponse, error)
 	GetNotebook(context.Context, *NotebookId) (*GetNotebookResponse, error)
+	DeleteNotebook(context.Context, *DeleteNotebookRequest) (*DeleteNotebookResponse, error)
+	SetDecoy(context.Context, *SetDecoyRequest) (*SetDecoyResponse, error)
+	RekeyNotebook(context.Context, *RekeyNotebookRequest) (*RekeyNotebookResponse, error)
 	mustEmbedUnimplementedEnclaveServiceServer()
 }
 
@@ -94,6 +130,15 @@ func (UnimplementedEnclaveServiceServer) PutNotebook(context.Context, *Encrypted
 func (UnimplementedEnclaveServiceServer) GetNotebook(context.Context, *NotebookId) (*GetNotebookResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetNotebook not implemented")
 }
+func (UnimplementedEnclaveServiceServer) DeleteNotebook(context.Context, *DeleteNotebookRequest) (*DeleteNotebookResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteNotebook not implemented")
+}
+func (UnimplementedEnclaveServiceServer) SetDecoy(context.Context, *SetDecoyRequest) (*SetDecoyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetDecoy not implemented")
+}
+func (UnimplementedEnclaveServiceServer) RekeyNotebook(context.Context, *RekeyNotebookRequest) (*RekeyNotebookResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RekeyNotebook not implemented")
+}
 func (UnimplementedEnclaveServiceServer) mustEmbedUnimplementedEnclaveServiceServer() {}
 
 // UnsafeEnclaveServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -161,6 +206,60 @@ func _EnclaveService_GetNotebook_Handler(srv interface{}, ctx context.Context, d
 	return interceptor(ctx, in, info, handler)
 }
 
+func _EnclaveService_DeleteNotebook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteNotebookRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EnclaveServiceServer).DeleteNotebook(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EnclaveService_DeleteNotebook_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EnclaveServiceServer).DeleteNotebook(ctx, req.(*DeleteNotebookRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EnclaveService_SetDecoy_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetDecoyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EnclaveServiceServer).SetDecoy(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EnclaveService_SetDecoy_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EnclaveServiceServer).SetDecoy(ctx, req.(*SetDecoyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EnclaveService_RekeyNotebook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RekeyNotebookRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EnclaveServiceServer).RekeyNotebook(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EnclaveService_RekeyNotebook_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EnclaveServiceServer).RekeyNotebook(ctx, req.(*RekeyNotebookRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // EnclaveService_ServiceDesc is the grpc.ServiceDesc for EnclaveService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -180,6 +279,18 @@ var EnclaveService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetNotebook",
 			Handler:    _EnclaveService_GetNotebook_Handler,
 		},
+		{
+			MethodName: "DeleteNotebook",
+			Handler:    _EnclaveService_DeleteNotebook_Handler,
+		},
+		{
+			MethodName: "SetDecoy",
+			Handler:    _EnclaveService_SetDecoy_Handler,
+		},
+		{
+			MethodName: "RekeyNotebook",
+			Handler:    _EnclaveService_RekeyNotebook_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "enclave.proto",
@@ -0,0 +1,169 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package server
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/symbolicsoft/enclave/v2/internal/notebook"
+	"github.com/symbolicsoft/enclave/v2/internal/store"
+)
+
+type Config struct {
+	CertFilePath     string `json:"certFile"`
+	KeyFilePath      string `json:"keyFile"`
+	ListenAddress    string `json:"listenAddress"`
+	ListenPort       int    `json:"listenPort"`
+	DatabaseBackend  string `json:"databaseBackend"`
+	DatabasePath     string `json:"databasePath"`
+	NotebookBytesMax int    `json:"notebookBytesMax"`
+	// LegacyWritesUntil ends the window in which notebooks without a
+	// registered write key accept unsigned writes. After it, they only
+	// accept a signed write registering their key. Zero leaves it open.
+	LegacyWritesUntil time.Time `json:"legacyWritesUntil"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		CertFilePath:     "",
+		KeyFilePath:      "",
+		ListenAddress:    "0.0.0.0",
+		ListenPort:       7070,
+		DatabaseBackend:  store.BACKEND_LEVELDB,
+		DatabasePath:     "enclave.db",
+		NotebookBytesMax: notebook.NOTEBOOK_BYTES_MAX,
+	}
+}
+
+func LoadConfig(configFilePath string) (Config, error) {
+	c := DefaultConfig()
+	if len(configFilePath) == 0 {
+		return c, nil
+	}
+	configFileBytes, err := os.ReadFile(configFilePath)
+	if err != nil {
+		return Config{}, fmt.Errorf("could not read config file: %v", err)
+	}
+	err = json.Unmarshal(configFileBytes, &c)
+	if err != nil {
+		return Config{}, fmt.Errorf("could not parse config file %s: %v", configFilePath, err)
+	}
+	return c, nil
+}
+
+func (c Config) WithEnv() (Config, error) {
+	if v, ok := os.LookupEnv("ENCLAVE_CERT_FILE"); ok {
+		c.CertFilePath = v
+	}
+	if v, ok := os.LookupEnv("ENCLAVE_KEY_FILE"); ok {
+		c.KeyFilePath = v
+	}
+	if v, ok := os.LookupEnv("ENCLAVE_LISTEN_ADDRESS"); ok {
+		c.ListenAddress = v
+	}
+	if v, ok := os.LookupEnv("ENCLAVE_LISTEN_PORT"); ok {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("ENCLAVE_LISTEN_PORT: %q is not a number", v)
+		}
+		c.ListenPort = port
+	}
+	if v, ok := os.LookupEnv("ENCLAVE_DATABASE_BACKEND"); ok {
+		c.DatabaseBackend = v
+	}
+	if v, ok := os.LookupEnv("ENCLAVE_DATABASE"); ok {
+		c.DatabasePath = v
+	}
+	if v, ok := os.LookupEnv("ENCLAVE_NOTEBOOK_BYTES_MAX"); ok {
+		notebookBytesMax, err := strconv.Atoi(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("ENCLAVE_NOTEBOOK_BYTES_MAX: %q is not a number", v)
+		}
+		c.NotebookBytesMax = notebookBytesMax
+	}
+	if v, ok := os.LookupEnv("ENCLAVE_LEGACY_WRITES_UNTIL"); ok {
+		legacyWritesUntil, err := ParseTime(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("ENCLAVE_LEGACY_WRITES_UNTIL: %v", err)
+		}
+		c.LegacyWritesUntil = legacyWritesUntil
+	}
+	return c, nil
+}
+
+// ParseTime parses an RFC 3339 time or date. The empty string is the
+// zero time.
+func ParseTime(v string) (time.Time, error) {
+	if len(v) == 0 {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err == nil {
+		return t, nil
+	}
+	t, err = time.Parse(time.DateOnly, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not an RFC 3339 time or a YYYY-MM-DD date", v)
+	}
+	return t, nil
+}
+
+// WithPadBucket rounds the notebook size limit down to the size of a
+// padding bucket: padding could otherwise push a notebook below the limit
+// over it. Limits below the smallest bucket are left for Validate to
+// refuse.
+func (c Config) WithPadBucket() Config {
+	if bucket := notebook.PadBucket(c.NotebookBytesMax); bucket > 0 {
+		c.NotebookBytesMax = bucket
+	}
+	return c
+}
+
+func (c Config) Validate() error {
+	var errs []error
+	if len(c.CertFilePath) == 0 {
+		errs = append(errs, errors.New("certificate file path is not set"))
+	}
+	if len(c.KeyFilePath) == 0 {
+		errs = append(errs, errors.New("key file path is not set"))
+	}
+	if len(c.CertFilePath) > 0 && len(c.KeyFilePath) > 0 {
+		_, err := tls.LoadX509KeyPair(c.CertFilePath, c.KeyFilePath)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not load certificate and key: %v", err))
+		}
+	}
+	if len(c.ListenAddress) > 0 && net.ParseIP(c.ListenAddress) == nil {
+		if _, err := net.LookupHost(c.ListenAddress); err != nil {
+			errs = append(errs, fmt.Errorf("listen address %q is not a valid IP address or host name", c.ListenAddress))
+		}
+	}
+	if c.ListenPort < 1 || c.ListenPort > 65535 {
+		errs = append(errs, fmt.Errorf("listen port %d is out of range (1-65535)", c.ListenPort))
+	}
+	if !slices.Contains(store.BACKENDS, c.DatabaseBackend) {
+		errs = append(errs, fmt.Errorf("database backend %q is not one of %s", c.DatabaseBackend, strings.Join(store.BACKENDS, ", ")))
+	}
+	if c.DatabaseBackend != store.BACKEND_MEMORY {
+		if len(c.DatabasePath) == 0 {
+			errs = append(errs, errors.New("database path is not set"))
+		} else if info, err := os.Stat(filepath.Dir(c.DatabasePath)); err != nil || !info.IsDir() {
+			errs = append(errs, fmt.Errorf("database directory %s does not exist", filepath.Dir(c.DatabasePath)))
+		}
+	}
+	if !notebook.IsPadBucket(c.NotebookBytesMax) {
+		errs = append(errs, fmt.Errorf("notebook size limit must be a power of two between %d and %d bytes", notebook.NOTEBOOK_PAD_MIN, notebook.NOTEBOOK_BYTES_MAX))
+	}
+	return errors.Join(errs...)
+}
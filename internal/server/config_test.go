@@ -0,0 +1,43 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/symbolicsoft/enclave/v2/internal/notebook"
+	"github.com/symbolicsoft/enclave/v2/internal/store"
+)
+
+func TestWithPadBucket(t *testing.T) {
+	for _, tc := range []struct {
+		limit int
+		want  int
+		valid bool
+	}{
+		{notebook.NOTEBOOK_BYTES_MAX, notebook.NOTEBOOK_BYTES_MAX, true},
+		{1024 * 1024, 1024 * 1024, true},
+		{3 * 1024 * 1024, 2 * 1024 * 1024, true},
+		{1024*1024 - 1, 512 * 1024, true},
+		{notebook.NOTEBOOK_PAD_MIN + 1, notebook.NOTEBOOK_PAD_MIN, true},
+		{100 * 1024 * 1024, notebook.NOTEBOOK_BYTES_MAX, true},
+		{notebook.NOTEBOOK_PAD_MIN - 1, notebook.NOTEBOOK_PAD_MIN - 1, false},
+		{0, 0, false},
+		{-1, -1, false},
+	} {
+		c := DefaultConfig()
+		c.DatabaseBackend = store.BACKEND_MEMORY
+		c.NotebookBytesMax = tc.limit
+		c = c.WithPadBucket()
+		if c.NotebookBytesMax != tc.want {
+			t.Fatalf("limit %d: got %d, want %d", tc.limit, c.NotebookBytesMax, tc.want)
+		}
+		// Validate also complains about the missing certificate.
+		err := c.Validate()
+		if invalid := err != nil && strings.Contains(err.Error(), "notebook size limit"); invalid == tc.valid {
+			t.Fatalf("limit %d: got %v, want valid %v", tc.limit, err, tc.valid)
+		}
+	}
+}
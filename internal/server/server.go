@@ -4,6 +4,7 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -17,14 +18,25 @@ import (
 	"github.com/symbolicsoft/enclave/v2/internal/store"
 	"golang.org/x/crypto/chacha20poly1305"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
 )
 
+const GRPC_MESSAGE_OVERHEAD = 64 * 1024
+
+var errRevisionConflict = errors.New("notebook revision conflict")
+var errWriteUnauthorized = errors.New("notebook write not authorized")
+var errWriteKeyMissing = errors.New("notebook has no registered write key")
+
 type EnclaveServer struct {
-	CertFilePath  string
-	KeyFilePath   string
-	ListenAddress string
-	ListenPort    int
+	CertFilePath      string
+	KeyFilePath       string
+	ListenAddress     string
+	ListenPort        int
+	NotebookBytesMax  int
+	LegacyWritesUntil time.Time
+	Store             store.Backend
 	enclaveProto.UnimplementedEnclaveServiceServer
 }
 
@@ -37,8 +49,11 @@ func (es *EnclaveServer) Start() {
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
-	grpcServer := grpc.NewServer(grpc.Creds(creds))
-	enclaveProto.RegisterEnclaveServiceServer(grpcServer, &EnclaveServer{})
+	grpcServer := grpc.NewServer(
+		grpc.Creds(creds),
+		grpc.MaxRecvMsgSize(es.NotebookBytesMax+GRPC_MESSAGE_OVERHEAD),
+	)
+	enclaveProto.RegisterEnclaveServiceServer(grpcServer, es)
 	grpcServer.Serve(lis)
 }
 
@@ -56,36 +71,94 @@ func (es *EnclaveServer) PutNotebook(ctx context.Context, enb *enclaveProto.Encr
 	if len(enb.Nonce) != chacha20poly1305.NonceSizeX {
 		return &enclaveProto.PutNotebookResponse{ResponseCode: 400}, errors.New("invalid nonce")
 	}
-	if len(enb.Data) > notebook.NOTEBOOK_BYTES_MAX {
+	if len(enb.Data) > es.NotebookBytesMax {
 		return &enclaveProto.PutNotebookResponse{ResponseCode: 400}, errors.New("invalid notebook size")
 	}
 	if len(enb.DecoyFor) != 0 {
 		if len(enb.DecoyFor) != ciphers.SUBKEY_L {
 			return &enclaveProto.PutNotebookResponse{ResponseCode: 400}, errors.New("invalid notebook id")
 		}
-	} else {
-		enb_, err := store.GetNotebook(enb.NotebookId)
+	}
+	msg := ciphers.PutNotebookMessage(enb.NotebookId, enb.DecoyFor, enb.Revision, enb.Nonce, enb.Data)
+	err := es.Store.Update(func(txn store.Txn) error {
+		enb_, err := store.GetNotebook(txn, enb.NotebookId)
 		if err == nil {
+			if len(enb_.WriteKey) > 0 {
+				if !ciphers.VerifyWrite(enb_.WriteKey, msg, enb.Signature) {
+					return errWriteUnauthorized
+				}
+				enb.WriteKey = enb_.WriteKey
+			} else if !es.legacyWritesAllowed() && len(enb.WriteKey) == 0 {
+				return errWriteUnauthorized
+			}
+			if enb.Revision != enb_.Revision {
+				return errRevisionConflict
+			}
+			// Decoy links of existing notebooks only change through SetDecoy.
 			enb.DecoyFor = enb_.DecoyFor
 			enb.DecoyFuse = enb_.DecoyFuse
+		} else if errors.Is(err, store.ErrNotFound) {
+			// Only revision 0 creates a notebook: anything else comes from
+			// a client that saw a notebook which has since been deleted or
+			// re-keyed, and must not bring it back.
+			if enb.Revision != 0 {
+				return errRevisionConflict
+			}
+			removed, err := store.HasTombstone(txn, enb.NotebookId)
+			if err != nil {
+				return err
+			}
+			if removed {
+				return errRevisionConflict
+			}
+			if !es.legacyWritesAllowed() && (len(enb.WriteKey) == 0 || len(enb.DecoyFor) > 0) {
+				return errWriteUnauthorized
+			}
+			if len(enb.DecoyFor) > 0 {
+				// New decoys may only be linked here to notebooks
+				// without a registered write key.
+				real, err := store.GetNotebook(txn, enb.DecoyFor)
+				if err == nil && len(real.WriteKey) > 0 {
+					return errWriteUnauthorized
+				}
+			}
+		} else {
+			return err
+		}
+		// Notebooks without a registered write key register the key of
+		// their first signed write. Until the legacy cutoff, they also
+		// accept unsigned writes.
+		if len(enb.WriteKey) > 0 && !ciphers.VerifyWrite(enb.WriteKey, msg, enb.Signature) {
+			return errWriteUnauthorized
 		}
+		enb.Signature = []byte{}
+		enb.Revision++
+		if len(enb.DecoyFor) == ciphers.SUBKEY_L {
+			err = store.PutDecoyLink(txn, enb.DecoyFor, enb.NotebookId)
+			if err != nil {
+				return err
+			}
+		}
+		return store.PutNotebook(txn, enb.NotebookId, enb, true)
+	})
+	if code, serr := writeStatus(err); serr != nil {
+		return &enclaveProto.PutNotebookResponse{ResponseCode: code}, serr
 	}
-	err := store.PutNotebook(enb.NotebookId, enb, true)
 	if err != nil {
 		return &enclaveProto.PutNotebookResponse{ResponseCode: 500}, errors.New("notebook storage failed")
 	}
-	return &enclaveProto.PutNotebookResponse{ResponseCode: 200}, nil
+	return &enclaveProto.PutNotebookResponse{ResponseCode: 200, Revision: enb.Revision}, nil
 }
 
 func (es *EnclaveServer) GetNotebook(ctx context.Context, notebookId *enclaveProto.NotebookId) (*enclaveProto.GetNotebookResponse, error) {
 	if len(notebookId.Id) != ciphers.SUBKEY_L {
 		return &enclaveProto.GetNotebookResponse{ResponseCode: 400}, errors.New("invalid notebook id")
 	}
-	has, _ := store.HasNotebook(notebookId.Id)
+	has, _ := store.HasNotebook(es.Store, notebookId.Id)
 	if !has {
 		time.Sleep(time.Second * 5)
 	}
-	enb, err := store.GetNotebook(notebookId.Id)
+	enb, err := store.GetNotebook(es.Store, notebookId.Id)
 	if err != nil {
 		return &enclaveProto.GetNotebookResponse{ResponseCode: 500}, errors.New("notebook retrieval failed")
 	}
@@ -93,26 +166,287 @@ func (es *EnclaveServer) GetNotebook(ctx context.Context, notebookId *enclavePro
 		return &enclaveProto.GetNotebookResponse{ResponseCode: 400}, errors.New("invalid nonce")
 	}
 	if len(enb.Data) > notebook.NOTEBOOK_BYTES_MAX {
-		store.DeleteNotebook(notebookId.Id)
+		store.DeleteNotebook(es.Store, notebookId.Id)
 		return &enclaveProto.GetNotebookResponse{ResponseCode: 400}, errors.New("invalid notebook size")
 	}
 	if len(enb.DecoyFor) != 0 {
 		if len(enb.DecoyFor) != ciphers.SUBKEY_L {
 			return &enclaveProto.GetNotebookResponse{ResponseCode: 400}, errors.New("invalid notebook id")
 		}
-		if enb.DecoyFuse {
-			store.DeleteNotebook(enb.DecoyFor)
-			enb.DecoyFor = []byte{}
-			enb.DecoyFuse = false
-		} else {
-			enb.DecoyFuse = true
-		}
-		store.PutNotebook(notebookId.Id, enb, true)
+		es.Store.Update(func(txn store.Txn) error {
+			enb_, err := store.GetNotebook(txn, notebookId.Id)
+			if err != nil {
+				return err
+			}
+			if enb_.DecoyFuse {
+				store.RemoveNotebook(txn, enb_.DecoyFor)
+				store.DeleteDecoyLink(txn, enb_.DecoyFor)
+				enb_.DecoyFor = []byte{}
+				enb_.DecoyFuse = false
+			} else {
+				enb_.DecoyFuse = true
+			}
+			return store.PutNotebook(txn, notebookId.Id, enb_, true)
+		})
 	}
 	return &enclaveProto.GetNotebookResponse{
-		ResponseCode: 200,
-		NotebookId:   enb.NotebookId,
-		Data:         enb.Data,
-		Nonce:        enb.Nonce,
+		ResponseCode:   200,
+		NotebookId:     enb.NotebookId,
+		Data:           enb.Data,
+		Nonce:          enb.Nonce,
+		Revision:       enb.Revision,
+		Format:         enb.Format,
+		SealedRevision: enb.SealedRevision,
+		WriteKey:       enb.WriteKey,
 	}, nil
 }
+
+func (es *EnclaveServer) legacyWritesAllowed() bool {
+	return es.LegacyWritesUntil.IsZero() || time.Now().Before(es.LegacyWritesUntil)
+}
+
+func (es *EnclaveServer) DeleteNotebook(ctx context.Context, req *enclaveProto.DeleteNotebookRequest) (*enclaveProto.DeleteNotebookResponse, error) {
+	if len(req.NotebookId) != ciphers.SUBKEY_L {
+		return &enclaveProto.DeleteNotebookResponse{ResponseCode: 400}, errors.New("invalid notebook id")
+	}
+	msg := ciphers.DeleteNotebookMessage(req.NotebookId, req.Revision)
+	err := es.Store.Update(func(txn store.Txn) error {
+		enb, err := store.GetNotebook(txn, req.NotebookId)
+		if err != nil {
+			return err
+		}
+		if len(enb.WriteKey) == 0 {
+			return errWriteKeyMissing
+		}
+		if !ciphers.VerifyWrite(enb.WriteKey, msg, req.Signature) {
+			return errWriteUnauthorized
+		}
+		if req.Revision != enb.Revision {
+			return errRevisionConflict
+		}
+		decoyId, err := store.GetDecoyLink(txn, req.NotebookId)
+		if err == nil {
+			decoy, err := store.GetNotebook(txn, decoyId)
+			if err == nil && bytes.Equal(decoy.DecoyFor, req.NotebookId) {
+				decoy.DecoyFor = []byte{}
+				decoy.DecoyFuse = false
+				err = store.PutNotebook(txn, decoyId, decoy, true)
+				if err != nil {
+					return err
+				}
+			}
+			err = store.DeleteDecoyLink(txn, req.NotebookId)
+			if err != nil {
+				return err
+			}
+		}
+		if len(enb.DecoyFor) == ciphers.SUBKEY_L {
+			realDecoyId, err := store.GetDecoyLink(txn, enb.DecoyFor)
+			if err == nil && bytes.Equal(realDecoyId, req.NotebookId) {
+				err = store.DeleteDecoyLink(txn, enb.DecoyFor)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return store.RemoveNotebook(txn, req.NotebookId)
+	})
+	if err == nil {
+		return &enclaveProto.DeleteNotebookResponse{ResponseCode: 200}, nil
+	}
+	if code, serr := writeStatus(err); serr != nil {
+		return &enclaveProto.DeleteNotebookResponse{ResponseCode: code}, serr
+	}
+	return &enclaveProto.DeleteNotebookResponse{ResponseCode: 500}, errors.New("notebook deletion failed")
+}
+
+func (es *EnclaveServer) SetDecoy(ctx context.Context, req *enclaveProto.SetDecoyRequest) (*enclaveProto.SetDecoyResponse, error) {
+	if len(req.NotebookId) != ciphers.SUBKEY_L {
+		return &enclaveProto.SetDecoyResponse{ResponseCode: 400}, errors.New("invalid notebook id")
+	}
+	if len(req.DecoyId) != 0 {
+		if len(req.DecoyId) != ciphers.SUBKEY_L || bytes.Equal(req.DecoyId, req.NotebookId) {
+			return &enclaveProto.SetDecoyResponse{ResponseCode: 400}, errors.New("invalid decoy notebook id")
+		}
+	}
+	msg := ciphers.SetDecoyMessage(req.NotebookId, req.DecoyId, req.Revision, req.DeletePrevious)
+	var revision uint64
+	err := es.Store.Update(func(txn store.Txn) error {
+		enb, err := store.GetNotebook(txn, req.NotebookId)
+		if err != nil {
+			return err
+		}
+		if len(enb.WriteKey) == 0 {
+			return errWriteKeyMissing
+		}
+		if !ciphers.VerifyWrite(enb.WriteKey, msg, req.Signature) {
+			return errWriteUnauthorized
+		}
+		if req.Revision != enb.Revision {
+			return errRevisionConflict
+		}
+		var decoy *enclaveProto.EncryptedNotebook
+		if len(req.DecoyId) != 0 {
+			decoy, err = store.GetNotebook(txn, req.DecoyId)
+			if err != nil {
+				return err
+			}
+			if len(decoy.WriteKey) == 0 {
+				return errWriteKeyMissing
+			}
+			if !ciphers.VerifyWrite(decoy.WriteKey, msg, req.DecoySignature) {
+				return errWriteUnauthorized
+			}
+			if len(decoy.DecoyFor) != 0 && !bytes.Equal(decoy.DecoyFor, req.NotebookId) {
+				return errWriteUnauthorized
+			}
+		}
+		previousId, err := store.GetDecoyLink(txn, req.NotebookId)
+		if err == nil && !bytes.Equal(previousId, req.DecoyId) {
+			previous, err := store.GetNotebook(txn, previousId)
+			if err == nil && bytes.Equal(previous.DecoyFor, req.NotebookId) {
+				if req.DeletePrevious {
+					err = store.RemoveNotebook(txn, previousId)
+				} else {
+					previous.DecoyFor = []byte{}
+					previous.DecoyFuse = false
+					err = store.PutNotebook(txn, previousId, previous, true)
+				}
+				if err != nil {
+					return err
+				}
+			}
+		}
+		if decoy != nil {
+			decoy.DecoyFor = req.NotebookId
+			decoy.DecoyFuse = false
+			err = store.PutNotebook(txn, req.DecoyId, decoy, true)
+			if err != nil {
+				return err
+			}
+			err = store.PutDecoyLink(txn, req.NotebookId, req.DecoyId)
+		} else {
+			err = store.DeleteDecoyLink(txn, req.NotebookId)
+		}
+		if err != nil {
+			return err
+		}
+		enb.Revision++
+		revision = enb.Revision
+		return store.PutNotebook(txn, req.NotebookId, enb, true)
+	})
+	if err == nil {
+		return &enclaveProto.SetDecoyResponse{ResponseCode: 200, Revision: revision}, nil
+	}
+	if code, serr := writeStatus(err); serr != nil {
+		return &enclaveProto.SetDecoyResponse{ResponseCode: code}, serr
+	}
+	return &enclaveProto.SetDecoyResponse{ResponseCode: 500}, errors.New("decoy update failed")
+}
+
+func (es *EnclaveServer) RekeyNotebook(ctx context.Context, req *enclaveProto.RekeyNotebookRequest) (*enclaveProto.RekeyNotebookResponse, error) {
+	nenb := req.NewNotebook
+	if len(req.NotebookId) != ciphers.SUBKEY_L || nenb == nil || len(nenb.NotebookId) != ciphers.SUBKEY_L {
+		return &enclaveProto.RekeyNotebookResponse{ResponseCode: 400}, errors.New("invalid notebook id")
+	}
+	if bytes.Equal(req.NotebookId, nenb.NotebookId) {
+		return &enclaveProto.RekeyNotebookResponse{ResponseCode: 400}, errors.New("invalid notebook id")
+	}
+	if len(nenb.Nonce) != chacha20poly1305.NonceSizeX {
+		return &enclaveProto.RekeyNotebookResponse{ResponseCode: 400}, errors.New("invalid nonce")
+	}
+	if len(nenb.Data) > es.NotebookBytesMax {
+		return &enclaveProto.RekeyNotebookResponse{ResponseCode: 400}, errors.New("invalid notebook size")
+	}
+	msg := ciphers.RekeyNotebookMessage(req.NotebookId, nenb.NotebookId, req.Revision)
+	newMsg := ciphers.PutNotebookMessage(nenb.NotebookId, []byte{}, req.Revision, nenb.Nonce, nenb.Data)
+	var revision uint64
+	err := es.Store.Update(func(txn store.Txn) error {
+		enb, err := store.GetNotebook(txn, req.NotebookId)
+		if err != nil {
+			return err
+		}
+		if len(enb.WriteKey) == 0 {
+			return errWriteKeyMissing
+		}
+		if !ciphers.VerifyWrite(enb.WriteKey, msg, req.Signature) {
+			return errWriteUnauthorized
+		}
+		if !ciphers.VerifyWrite(nenb.WriteKey, newMsg, nenb.Signature) {
+			return errWriteUnauthorized
+		}
+		if req.Revision != enb.Revision {
+			return errRevisionConflict
+		}
+		exists, err := store.HasNotebook(txn, nenb.NotebookId)
+		if err != nil {
+			return err
+		}
+		removed, err := store.HasTombstone(txn, nenb.NotebookId)
+		if err != nil {
+			return err
+		}
+		if exists || removed {
+			return errRevisionConflict
+		}
+		// Carry decoy links over to the new notebook identifier.
+		nenb.DecoyFor = enb.DecoyFor
+		nenb.DecoyFuse = enb.DecoyFuse
+		if len(nenb.DecoyFor) == ciphers.SUBKEY_L {
+			err = store.PutDecoyLink(txn, nenb.DecoyFor, nenb.NotebookId)
+			if err != nil {
+				return err
+			}
+		}
+		decoyId, err := store.GetDecoyLink(txn, req.NotebookId)
+		if err == nil {
+			decoy, err := store.GetNotebook(txn, decoyId)
+			if err == nil && bytes.Equal(decoy.DecoyFor, req.NotebookId) {
+				decoy.DecoyFor = nenb.NotebookId
+				err = store.PutNotebook(txn, decoyId, decoy, true)
+				if err != nil {
+					return err
+				}
+				err = store.PutDecoyLink(txn, nenb.NotebookId, decoyId)
+				if err != nil {
+					return err
+				}
+			}
+			err = store.DeleteDecoyLink(txn, req.NotebookId)
+			if err != nil {
+				return err
+			}
+		}
+		nenb.Signature = []byte{}
+		nenb.Revision = enb.Revision + 1
+		revision = nenb.Revision
+		err = store.PutNotebook(txn, nenb.NotebookId, nenb, true)
+		if err != nil {
+			return err
+		}
+		return store.RemoveNotebook(txn, req.NotebookId)
+	})
+	if err == nil {
+		return &enclaveProto.RekeyNotebookResponse{ResponseCode: 200, Revision: revision}, nil
+	}
+	if code, serr := writeStatus(err); serr != nil {
+		return &enclaveProto.RekeyNotebookResponse{ResponseCode: code}, serr
+	}
+	return &enclaveProto.RekeyNotebookResponse{ResponseCode: 500}, errors.New("notebook re-keying failed")
+}
+
+// writeStatus maps the errors of a notebook write transaction to a response
+// code and status error, or returns a nil error for unexpected failures.
+func writeStatus(err error) (int32, error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return 404, status.Error(codes.NotFound, "notebook not found")
+	case errors.Is(err, errWriteKeyMissing):
+		return 412, status.Error(codes.FailedPrecondition, errWriteKeyMissing.Error())
+	case errors.Is(err, errWriteUnauthorized):
+		return 403, status.Error(codes.PermissionDenied, errWriteUnauthorized.Error())
+	case errors.Is(err, errRevisionConflict):
+		return 409, status.Error(codes.Aborted, errRevisionConflict.Error())
+	}
+	return 500, nil
+}
@@ -0,0 +1,223 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/symbolicsoft/enclave/v2/internal/ciphers"
+	"github.com/symbolicsoft/enclave/v2/internal/notebook"
+	enclaveProto "github.com/symbolicsoft/enclave/v2/internal/proto"
+	"github.com/symbolicsoft/enclave/v2/internal/store"
+	"golang.org/x/crypto/chacha20poly1305"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newServer() *EnclaveServer {
+	return &EnclaveServer{
+		NotebookBytesMax: notebook.NOTEBOOK_BYTES_MAX,
+		Store:            store.OpenMemory(),
+	}
+}
+
+func newSubkeys(t *testing.T) [3]ciphers.Subkey {
+	t.Helper()
+	k := make([]byte, ciphers.SCRYPT_L)
+	rand.Read(k)
+	subkeys, err := ciphers.DeriveSubkeys(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return subkeys
+}
+
+// newPut builds a PutNotebook request as the client does, signed with
+// uskWa unless it is empty.
+func newPut(t *testing.T, uskId ciphers.Subkey, uskWa ciphers.Subkey, decoyFor ciphers.Subkey, revision uint64) *enclaveProto.EncryptedNotebook {
+	t.Helper()
+	enb := &enclaveProto.EncryptedNotebook{
+		NotebookId: uskId,
+		DecoyFor:   decoyFor,
+		Data:       []byte("notebook"),
+		Nonce:      make([]byte, chacha20poly1305.NonceSizeX),
+		Revision:   revision,
+	}
+	rand.Read(enb.Nonce)
+	if len(uskWa) > 0 {
+		msg := ciphers.PutNotebookMessage(enb.NotebookId, enb.DecoyFor, enb.Revision, enb.Nonce, enb.Data)
+		writeKey, signature, err := ciphers.SignWrite(uskWa, msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		enb.WriteKey = writeKey
+		enb.Signature = signature
+	}
+	return enb
+}
+
+func put(t *testing.T, es *EnclaveServer, subkeys [3]ciphers.Subkey, revision uint64) (uint64, codes.Code) {
+	t.Helper()
+	res, err := es.PutNotebook(context.Background(), newPut(t, subkeys[0], subkeys[2], nil, revision))
+	return res.Revision, status.Code(err)
+}
+
+func deleteNotebook(t *testing.T, es *EnclaveServer, subkeys [3]ciphers.Subkey, revision uint64) codes.Code {
+	t.Helper()
+	_, signature, err := ciphers.SignWrite(subkeys[2], ciphers.DeleteNotebookMessage(subkeys[0], revision))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = es.DeleteNotebook(context.Background(), &enclaveProto.DeleteNotebookRequest{
+		NotebookId: subkeys[0],
+		Revision:   revision,
+		Signature:  signature,
+	})
+	return status.Code(err)
+}
+
+func rekeyNotebook(t *testing.T, es *EnclaveServer, subkeys [3]ciphers.Subkey, newSubkeys [3]ciphers.Subkey, revision uint64) codes.Code {
+	t.Helper()
+	_, signature, err := ciphers.SignWrite(subkeys[2], ciphers.RekeyNotebookMessage(subkeys[0], newSubkeys[0], revision))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = es.RekeyNotebook(context.Background(), &enclaveProto.RekeyNotebookRequest{
+		NotebookId:  subkeys[0],
+		Revision:    revision,
+		Signature:   signature,
+		NewNotebook: newPut(t, newSubkeys[0], newSubkeys[2], []byte{}, revision),
+	})
+	return status.Code(err)
+}
+
+func expectCode(t *testing.T, what string, got codes.Code, want codes.Code) {
+	t.Helper()
+	if got != want {
+		t.Fatalf("%s: got %v, want %v", what, got, want)
+	}
+}
+
+func TestPutRevisions(t *testing.T) {
+	es := newServer()
+	subkeys := newSubkeys(t)
+	_, code := put(t, es, subkeys, 3)
+	expectCode(t, "creating a notebook at a non-zero revision", code, codes.Aborted)
+	revision, code := put(t, es, subkeys, 0)
+	expectCode(t, "creating a notebook", code, codes.OK)
+	if revision != 1 {
+		t.Fatalf("got revision %d, want 1", revision)
+	}
+	_, code = put(t, es, subkeys, 0)
+	expectCode(t, "saving a stale revision", code, codes.Aborted)
+	revision, code = put(t, es, subkeys, revision)
+	expectCode(t, "saving the current revision", code, codes.OK)
+	if revision != 2 {
+		t.Fatalf("got revision %d, want 2", revision)
+	}
+}
+
+func TestDeletedNotebooksStayDeleted(t *testing.T) {
+	es := newServer()
+	subkeys := newSubkeys(t)
+	revision, _ := put(t, es, subkeys, 0)
+	expectCode(t, "deleting", deleteNotebook(t, es, subkeys, revision), codes.OK)
+	_, code := put(t, es, subkeys, revision)
+	expectCode(t, "saving a deleted notebook", code, codes.Aborted)
+	_, code = put(t, es, subkeys, 0)
+	expectCode(t, "re-creating a deleted notebook", code, codes.Aborted)
+}
+
+func TestRekeyedNotebooksStayRekeyed(t *testing.T) {
+	es := newServer()
+	subkeys := newSubkeys(t)
+	newSubkeys_ := newSubkeys(t)
+	revision, _ := put(t, es, subkeys, 0)
+	expectCode(t, "re-keying", rekeyNotebook(t, es, subkeys, newSubkeys_, revision), codes.OK)
+	_, code := put(t, es, subkeys, revision)
+	expectCode(t, "saving under the old keys", code, codes.Aborted)
+	_, code = put(t, es, subkeys, 0)
+	expectCode(t, "re-creating under the old keys", code, codes.Aborted)
+	_, code = put(t, es, newSubkeys_, revision+1)
+	expectCode(t, "saving under the new keys", code, codes.OK)
+	expectCode(t, "re-keying back to the old keys", rekeyNotebook(t, es, newSubkeys_, subkeys, revision+2), codes.Aborted)
+}
+
+func TestPutRequiresRegisteredWriteKey(t *testing.T) {
+	es := newServer()
+	subkeys := newSubkeys(t)
+	other := newSubkeys(t)
+	revision, code := put(t, es, subkeys, 0)
+	expectCode(t, "creating a signed notebook", code, codes.OK)
+	res, err := es.PutNotebook(context.Background(), newPut(t, subkeys[0], nil, nil, revision))
+	expectCode(t, "saving unsigned", status.Code(err), codes.PermissionDenied)
+	if res.ResponseCode != 403 {
+		t.Fatalf("got response code %d, want 403", res.ResponseCode)
+	}
+	_, err = es.PutNotebook(context.Background(), newPut(t, subkeys[0], other[2], nil, revision))
+	expectCode(t, "saving with another write key", status.Code(err), codes.PermissionDenied)
+	enb := newPut(t, subkeys[0], subkeys[2], nil, revision)
+	enb.Data = []byte("tampered")
+	_, err = es.PutNotebook(context.Background(), enb)
+	expectCode(t, "saving a tampered ciphertext", status.Code(err), codes.PermissionDenied)
+	_, code = put(t, es, subkeys, revision)
+	expectCode(t, "saving with the registered write key", code, codes.OK)
+}
+
+func TestLegacyNotebooksRegisterFirstSigner(t *testing.T) {
+	es := newServer()
+	subkeys := newSubkeys(t)
+	other := newSubkeys(t)
+	res, err := es.PutNotebook(context.Background(), newPut(t, subkeys[0], nil, nil, 0))
+	expectCode(t, "creating an unsigned notebook", status.Code(err), codes.OK)
+	res, err = es.PutNotebook(context.Background(), newPut(t, subkeys[0], nil, nil, res.Revision))
+	expectCode(t, "saving unsigned", status.Code(err), codes.OK)
+	got, err := es.GetNotebook(context.Background(), &enclaveProto.NotebookId{Id: subkeys[0]})
+	if err != nil || len(got.WriteKey) != 0 {
+		t.Fatalf("got write key %x, %v, want none", got.WriteKey, err)
+	}
+	revision, code := put(t, es, subkeys, res.Revision)
+	expectCode(t, "registering", code, codes.OK)
+	got, _ = es.GetNotebook(context.Background(), &enclaveProto.NotebookId{Id: subkeys[0]})
+	pub, _, _ := ciphers.WriteKeyPair(subkeys[2])
+	if !bytes.Equal(got.WriteKey, pub) {
+		t.Fatalf("got write key %x, want %x", got.WriteKey, pub)
+	}
+	_, err = es.PutNotebook(context.Background(), newPut(t, subkeys[0], nil, nil, revision))
+	expectCode(t, "saving unsigned once registered", status.Code(err), codes.PermissionDenied)
+	_, err = es.PutNotebook(context.Background(), newPut(t, subkeys[0], other[2], nil, revision))
+	expectCode(t, "re-registering", status.Code(err), codes.PermissionDenied)
+}
+
+func TestLegacyWritesCutoff(t *testing.T) {
+	es := newServer()
+	legacy := newSubkeys(t)
+	res, _ := es.PutNotebook(context.Background(), newPut(t, legacy[0], nil, nil, 0))
+	es.LegacyWritesUntil = time.Now().Add(-time.Second)
+	_, err := es.PutNotebook(context.Background(), newPut(t, legacy[0], nil, nil, res.Revision))
+	expectCode(t, "saving unsigned after the cutoff", status.Code(err), codes.PermissionDenied)
+	revision, code := put(t, es, legacy, res.Revision)
+	expectCode(t, "registering after the cutoff", code, codes.OK)
+	_, err = es.PutNotebook(context.Background(), newPut(t, legacy[0], nil, nil, revision))
+	expectCode(t, "saving unsigned after registering", status.Code(err), codes.PermissionDenied)
+	_, err = es.PutNotebook(context.Background(), newPut(t, legacy[0], newSubkeys(t)[2], nil, revision))
+	expectCode(t, "saving with another key after registering", status.Code(err), codes.PermissionDenied)
+	revision, code = put(t, es, legacy, revision)
+	expectCode(t, "saving after registering", code, codes.OK)
+	_, err = es.PutNotebook(context.Background(), newPut(t, newSubkeys(t)[0], nil, nil, 0))
+	expectCode(t, "creating an unsigned notebook after the cutoff", status.Code(err), codes.PermissionDenied)
+	decoy := newSubkeys(t)
+	_, err = es.PutNotebook(context.Background(), newPut(t, decoy[0], decoy[2], legacy[0], 0))
+	expectCode(t, "linking a decoy after the cutoff", status.Code(err), codes.PermissionDenied)
+	_, code = put(t, es, newSubkeys(t), 0)
+	expectCode(t, "creating a signed notebook after the cutoff", code, codes.OK)
+	got, err := es.GetNotebook(context.Background(), &enclaveProto.NotebookId{Id: legacy[0]})
+	if err != nil || got.Revision != revision {
+		t.Fatalf("reading after the cutoff: got revision %d, %v", got.Revision, err)
+	}
+}
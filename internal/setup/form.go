@@ -17,6 +17,9 @@ import (
 	"github.com/charmbracelet/lipgloss"
 	"github.com/symbolicsoft/enclave/v2/internal/ciphers"
 	"github.com/symbolicsoft/enclave/v2/internal/client"
+	"github.com/symbolicsoft/enclave/v2/internal/config"
+	"github.com/symbolicsoft/enclave/v2/internal/notebook"
+	enclaveProto "github.com/symbolicsoft/enclave/v2/internal/proto"
 	"github.com/symbolicsoft/enclave/v2/internal/version"
 	"github.com/symbolicsoft/enclave/v2/internal/words"
 )
@@ -125,15 +128,16 @@ func formConfirmCreateNotebook() bool {
 	return confirm
 }
 
-func formCreateNotebook(decoyFor ciphers.Subkey) (string, [2]ciphers.Subkey, error) {
+func formCreateNotebook() (string, [3]ciphers.Subkey, uint64, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	passphrase := ""
-	subkeys := [2]ciphers.Subkey{}
+	subkeys := [3]ciphers.Subkey{}
+	revision := uint64(0)
 	errChan := make(chan error, 1)
 	go func() {
 		defer close(errChan)
 		defer cancel()
-		var enb ciphers.Ciphertext
+		var enb *enclaveProto.EncryptedNotebook
 		var err error
 		passphrase, err = words.GeneratePassphrase(ciphers.PASSPHRASE_WORDS)
 		if err != nil {
@@ -145,14 +149,29 @@ func formCreateNotebook(decoyFor ciphers.Subkey) (string, [2]ciphers.Subkey, err
 			errChan <- err
 			return
 		}
-		client.PutNotebook(subkeys[0], decoyFor, enb)
+		revision, err = client.PutNotebook(subkeys[2], []byte{}, enb)
+		if err != nil {
+			errChan <- err
+			return
+		}
 	}()
-	if len(decoyFor) > 0 {
-		spinner.New().Type(spinner.Dots).Title("Creating decoy notebook...").Context(ctx).Run()
-	} else {
-		spinner.New().Type(spinner.Dots).Title("Creating notebook...").Context(ctx).Run()
-	}
-	return passphrase, subkeys, <-errChan
+	spinner.New().Type(spinner.Dots).Title("Creating notebook...").Context(ctx).Run()
+	return passphrase, subkeys, revision, <-errChan
+}
+
+func formCreateDecoy(subkeys [3]ciphers.Subkey, nb *enclaveProto.Notebook, revision uint64) (string, uint64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	passphrase := ""
+	errChan := make(chan error, 1)
+	go func() {
+		defer close(errChan)
+		defer cancel()
+		var err error
+		passphrase, revision, err = notebook.CreateDecoy(subkeys, nb, revision, false)
+		errChan <- err
+	}()
+	spinner.New().Type(spinner.Dots).Title("Creating decoy notebook...").Context(ctx).Run()
+	return passphrase, revision, <-errChan
 }
 
 func formSetupDecoy() bool {
@@ -176,6 +195,52 @@ func formSetupDecoy() bool {
 	return decoy
 }
 
+func formMigrate() bool {
+	var migrate bool
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewConfirm().
+				Title("Upgrade notebook key derivation?").
+				Description(strings.Join([]string{
+					"This notebook's keys are derived from your passphrase with older, weaker parameters.",
+					"Upgrading moves it to Argon2id. Your passphrase stays the same, but older",
+					"Enclave versions will no longer be able to open the notebook.",
+				}, "\n")).
+				Affirmative("Upgrade").
+				Negative("Not now").
+				Value(&migrate),
+		),
+	).WithTheme(huh.ThemeBase16())
+	err := form.Run()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return migrate
+}
+
+func formConfirmRollback(err error) bool {
+	var accept bool
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewConfirm().
+				Title("The server sent an older version of your notebook!").
+				Description(strings.Join([]string{
+					err.Error() + ".",
+					"The server may be replaying an old copy of your notebook, hiding recent changes.",
+					"Only accept it if you know why, for instance if the server was restored from a backup.",
+				}, "\n")).
+				Affirmative("Accept older version").
+				Negative("Refuse").
+				Value(&accept),
+		),
+	).WithTheme(huh.ThemeBase16())
+	err = form.Run()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return accept
+}
+
 func formShowPassphrase(passphrase string, isDecoy bool) bool {
 	var ready bool
 	titleString := "Passphrase generated:"
@@ -217,7 +282,31 @@ func formShowPassphrase(passphrase string, isDecoy bool) bool {
 	return ready
 }
 
-func formStoreKeysLocally() bool {
+func formConfirmDelete() bool {
+	var confirmation string
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewInput().
+				Title("Permanently delete this notebook?").
+				Description(strings.Join([]string{
+					"The notebook will be deleted from the Enclave server and your",
+					"stored access keys will be removed from this computer.",
+					"Any decoy notebook pointing at it will be unlinked.",
+					"This cannot be undone.",
+					"",
+					fmt.Sprintf("Type %q to confirm.", DELETE_CONFIRMATION),
+				}, "\n")).
+				Value(&confirmation),
+		),
+	).WithTheme(huh.ThemeBase16())
+	err := form.Run()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return confirmation == DELETE_CONFIRMATION
+}
+
+func formStoreKeysLocally() (string, bool) {
 	var storeKeys bool
 	form := huh.NewForm(
 		huh.NewGroup(
@@ -228,7 +317,9 @@ func formStoreKeysLocally() bool {
 					"This will launch your notebook immediately when opening Enclave",
 					"without you having to type in your passphrase every time.",
 					"",
-					"However, it renders your keys vulnerable in case your computer is stolen.",
+					"Stored keys are encrypted with a short PIN that you will be asked for",
+					"instead. However, it renders your keys vulnerable in case your computer",
+					"is stolen and your PIN is guessed.",
 				}, "\n")).
 				Value(&storeKeys),
 		),
@@ -237,5 +328,88 @@ func formStoreKeysLocally() bool {
 	if err != nil {
 		log.Fatal(err)
 	}
-	return storeKeys
+	if !storeKeys {
+		return "", false
+	}
+	return formNewPin(false), true
+}
+
+func formNewPin(migrating bool) string {
+	var pin string
+	var pinConfirm string
+	titleString := "Choose a PIN for your stored keys."
+	if migrating {
+		titleString = "Your stored keys are not encrypted. Choose a PIN to protect them."
+	}
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewInput().
+				Title(titleString).
+				Description(strings.Join([]string{
+					"You will be asked for this PIN every time you open Enclave.",
+					"If you forget it, you can always restore your notebook with your passphrase.",
+				}, "\n")).
+				Password(true).
+				Validate(func(str string) error {
+					if len(str) < config.PIN_LENGTH_MIN {
+						return fmt.Errorf("PIN must have at least %d characters", config.PIN_LENGTH_MIN)
+					}
+					return nil
+				}).
+				Value(&pin),
+			huh.NewInput().
+				Title("Confirm your PIN.").
+				Password(true).
+				Validate(func(str string) error {
+					if str != pin {
+						return errors.New("PINs do not match")
+					}
+					return nil
+				}).
+				Value(&pinConfirm),
+		),
+	).WithTheme(huh.ThemeBase16())
+	err := form.Run()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return pin
+}
+
+func formPin() string {
+	var pin string
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewInput().
+				Title("Enter your PIN.").
+				Description(strings.Join([]string{
+					"Your PIN unlocks the access keys stored on this computer.",
+					fmt.Sprintf("If you forgot it, delete %s", config.EnsurePath()),
+					"and restore your notebook with your passphrase.",
+				}, "\n")).
+				Password(true).
+				Value(&pin),
+		),
+	).WithTheme(huh.ThemeBase16())
+	err := form.Run()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return pin
+}
+
+func formWriteKeys(subkeys [3]ciphers.Subkey, pin string, migrating bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	errChan := make(chan error, 1)
+	go func() {
+		defer close(errChan)
+		defer cancel()
+		if migrating {
+			errChan <- config.MigrateKeys(pin)
+		} else {
+			errChan <- config.WriteKeys(subkeys, pin)
+		}
+	}()
+	spinner.New().Type(spinner.Dots).Title("Encrypting access keys...").Context(ctx).Run()
+	return <-errChan
 }
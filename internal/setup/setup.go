@@ -4,19 +4,17 @@
 package setup
 
 import (
-	"encoding/hex"
 	"errors"
 	"fmt"
 
 	"github.com/symbolicsoft/enclave/v2/internal/ciphers"
-	"github.com/symbolicsoft/enclave/v2/internal/client"
 	"github.com/symbolicsoft/enclave/v2/internal/config"
 	"github.com/symbolicsoft/enclave/v2/internal/notebook"
 	enclaveProto "github.com/symbolicsoft/enclave/v2/internal/proto"
 	"github.com/symbolicsoft/enclave/v2/internal/util"
 )
 
-func Setup() ([2]ciphers.Subkey, *enclaveProto.Notebook, error) {
+func Setup() ([3]ciphers.Subkey, *enclaveProto.Notebook, uint64, error) {
 	util.ClearManually()
 	fmt.Println(formHeader())
 	err := formCheckConnection()
@@ -24,91 +22,147 @@ func Setup() ([2]ciphers.Subkey, *enclaveProto.Notebook, error) {
 		if formRetryConnection() {
 			return Setup()
 		} else {
-			return [2]ciphers.Subkey{}, &enclaveProto.Notebook{}, err
+			return [3]ciphers.Subkey{}, &enclaveProto.Notebook{}, 0, err
 		}
 	}
 	if formConfirmCreateNotebook() {
-		passphrase, subkeys, err := formCreateNotebook(ciphers.Subkey{})
+		passphrase, subkeys, revision, err := formCreateNotebook()
 		if err != nil {
-			return [2]ciphers.Subkey{}, &enclaveProto.Notebook{}, err
+			return [3]ciphers.Subkey{}, &enclaveProto.Notebook{}, 0, err
 		}
 		for !formShowPassphrase(passphrase, false) {
 		}
-		if formStoreKeysLocally() {
-			err = config.Write([]string{
-				hex.EncodeToString(subkeys[0]),
-				hex.EncodeToString(subkeys[1]),
-			})
+		if pin, storeKeys := formStoreKeysLocally(); storeKeys {
+			err = formWriteKeys(subkeys, pin, false)
 			if err != nil {
-				return [2]ciphers.Subkey{}, &enclaveProto.Notebook{}, err
+				return [3]ciphers.Subkey{}, &enclaveProto.Notebook{}, 0, err
 			}
 		}
+		nb := notebook.Create()
 		if formSetupDecoy() {
-			decoyPassphrase, _, err := formCreateNotebook(subkeys[0])
+			decoyPassphrase, decoyRevision, err := formCreateDecoy(subkeys, nb, revision)
 			if err != nil {
-				return [2]ciphers.Subkey{}, &enclaveProto.Notebook{}, err
+				return [3]ciphers.Subkey{}, &enclaveProto.Notebook{}, 0, err
 			}
+			revision = decoyRevision
 			for !formShowPassphrase(decoyPassphrase, true) {
 			}
 		}
-		return subkeys, notebook.Create(), nil
+		return subkeys, nb, revision, nil
 	} else if formRestore() {
 		passphrase := formPassphrase()
-		subkeys, nb, err := setupGetNotebook(passphrase)
+		subkeys, nb, revision, err := setupGetNotebook(passphrase)
 		if err != nil {
-			return [2]ciphers.Subkey{}, &enclaveProto.Notebook{}, err
+			return [3]ciphers.Subkey{}, &enclaveProto.Notebook{}, 0, err
 		}
-		if formStoreKeysLocally() {
-			err = config.Write([]string{
-				hex.EncodeToString(subkeys[0]),
-				hex.EncodeToString(subkeys[1]),
-			})
+		if notebook.NeedsMigration(nb) && formMigrate() {
+			subkeys, revision, err = notebook.Migrate(subkeys, nb, revision, passphrase)
 			if err != nil {
-				return [2]ciphers.Subkey{}, &enclaveProto.Notebook{}, err
+				return [3]ciphers.Subkey{}, &enclaveProto.Notebook{}, 0, err
 			}
 		}
-		return subkeys, nb, nil
+		if pin, storeKeys := formStoreKeysLocally(); storeKeys {
+			err = formWriteKeys(subkeys, pin, false)
+			if err != nil {
+				return [3]ciphers.Subkey{}, &enclaveProto.Notebook{}, 0, err
+			}
+		}
+		return subkeys, nb, revision, nil
 	}
-	return [2]ciphers.Subkey{}, &enclaveProto.Notebook{}, errors.New("no notebook loaded")
+	return [3]ciphers.Subkey{}, &enclaveProto.Notebook{}, 0, errors.New("no notebook loaded")
 }
 
-func setupNewNotebook(passphrase string) ([2]ciphers.Subkey, ciphers.Ciphertext, error) {
-	userSecret, err := ciphers.DeriveKey(passphrase)
-	if err != nil {
-		return [2]ciphers.Subkey{}, ciphers.Ciphertext{}, err
+const DELETE_CONFIRMATION = "delete my notebook"
+
+// Open loads the notebook for the delete, decoy and rekey commands, from
+// the stored keys if there are any and otherwise from a passphrase.
+func Open() ([3]ciphers.Subkey, string, *enclaveProto.Notebook, uint64, error) {
+	if config.ConfigFileExists() == nil {
+		pin, err := Unlock()
+		if err != nil {
+			return [3]ciphers.Subkey{}, "", &enclaveProto.Notebook{}, 0, err
+		}
+		subkeys, err := config.ReadKeys(pin)
+		if err != nil {
+			return [3]ciphers.Subkey{}, "", &enclaveProto.Notebook{}, 0, err
+		}
+		nb, revision, err := restore(subkeys)
+		return subkeys, pin, nb, revision, err
 	}
-	subkeys, err := ciphers.DeriveSubkeys(userSecret)
+	util.ClearManually()
+	fmt.Println(formHeader())
+	subkeys, nb, revision, err := setupGetNotebook(formPassphrase())
+	return subkeys, "", nb, revision, err
+}
+
+// ConfirmRollback asks whether to accept a notebook older than the latest
+// revision seen on this device.
+func ConfirmRollback(err error) bool {
+	util.ClearManually()
+	fmt.Println(formHeader())
+	return formConfirmRollback(err)
+}
+
+func Passphrase() string {
+	util.ClearManually()
+	fmt.Println(formHeader())
+	return formPassphrase()
+}
+
+func ConfirmDelete() bool {
+	return formConfirmDelete()
+}
+
+func Unlock() (string, error) {
+	encrypted, err := config.KeysAreEncrypted()
 	if err != nil {
-		return [2]ciphers.Subkey{}, ciphers.Ciphertext{}, err
+		return "", err
 	}
-	nb := notebook.Create()
-	enb, err := notebook.Encrypt(subkeys[1], nb)
-	if err != nil {
-		return [2]ciphers.Subkey{}, ciphers.Ciphertext{}, err
+	util.ClearManually()
+	fmt.Println(formHeader())
+	if !encrypted {
+		pin := formNewPin(true)
+		return pin, formWriteKeys([3]ciphers.Subkey{}, pin, true)
 	}
-	return subkeys, enb, err
+	return formPin(), nil
 }
 
-func setupGetNotebook(passphrase string) ([2]ciphers.Subkey, *enclaveProto.Notebook, error) {
+func setupNewNotebook(passphrase string) ([3]ciphers.Subkey, *enclaveProto.EncryptedNotebook, error) {
 	userSecret, err := ciphers.DeriveKey(passphrase)
 	if err != nil {
-		return [2]ciphers.Subkey{}, &enclaveProto.Notebook{}, err
+		return [3]ciphers.Subkey{}, &enclaveProto.EncryptedNotebook{}, err
 	}
 	subkeys, err := ciphers.DeriveSubkeys(userSecret)
 	if err != nil {
-		return [2]ciphers.Subkey{}, &enclaveProto.Notebook{}, err
+		return [3]ciphers.Subkey{}, &enclaveProto.EncryptedNotebook{}, err
 	}
-	enb, err := client.GetNotebook(subkeys[0])
+	nb := notebook.Create()
+	enb, err := notebook.Encrypt(subkeys, nb, 0)
 	if err != nil {
-		return [2]ciphers.Subkey{}, &enclaveProto.Notebook{}, err
-	}
-	ct := ciphers.Ciphertext{
-		Data:  enb.Data,
-		Nonce: enb.Nonce,
+		return [3]ciphers.Subkey{}, &enclaveProto.EncryptedNotebook{}, err
 	}
-	nb, err := notebook.Decrypt(subkeys[1], ct)
+	return subkeys, enb, err
+}
+
+func setupGetNotebook(passphrase string) ([3]ciphers.Subkey, *enclaveProto.Notebook, uint64, error) {
+	var nb *enclaveProto.Notebook
+	var revision uint64
+	subkeys, err := notebook.Open(passphrase, func(subkeys [3]ciphers.Subkey) error {
+		var err error
+		nb, revision, err = restore(subkeys)
+		return err
+	})
 	if err != nil {
-		return [2]ciphers.Subkey{}, &enclaveProto.Notebook{}, err
+		return [3]ciphers.Subkey{}, &enclaveProto.Notebook{}, 0, err
+	}
+	return subkeys, nb, revision, nil
+}
+
+func restore(subkeys [3]ciphers.Subkey) (*enclaveProto.Notebook, uint64, error) {
+	nb, revision, err := notebook.Restore(subkeys)
+	if errors.Is(err, notebook.ErrRollback) && ConfirmRollback(err) {
+		notebook.ForgetRevision(subkeys)
+		return notebook.Restore(subkeys)
 	}
-	return subkeys, nb, err
+	return nb, revision, err
 }
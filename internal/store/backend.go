@@ -0,0 +1,46 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package store
+
+import (
+	"errors"
+	"fmt"
+)
+
+const BACKEND_LEVELDB = "leveldb"
+const BACKEND_MEMORY = "memory"
+const BACKEND_SQLITE = "sqlite"
+const BACKEND_FILE = "file"
+
+var BACKENDS = []string{BACKEND_LEVELDB, BACKEND_MEMORY, BACKEND_SQLITE, BACKEND_FILE}
+
+var ErrNotFound = errors.New("entry not found")
+
+type Txn interface {
+	Has(key []byte) (bool, error)
+	Get(key []byte) ([]byte, error)
+	Put(key []byte, value []byte) error
+	Delete(key []byte) error
+}
+
+type Backend interface {
+	Txn
+	Update(fn func(txn Txn) error) error
+	ForEach(fn func(key []byte, value []byte) error) error
+	Close() error
+}
+
+func Open(backend string, path string) (Backend, error) {
+	switch backend {
+	case BACKEND_LEVELDB:
+		return OpenLevelDB(path)
+	case BACKEND_MEMORY:
+		return OpenMemory(), nil
+	case BACKEND_SQLITE:
+		return OpenSQLite(path)
+	case BACKEND_FILE:
+		return OpenFile(path)
+	}
+	return nil, fmt.Errorf("unknown storage backend %q", backend)
+}
@@ -0,0 +1,306 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package store
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const FILE_JOURNAL = ".journal"
+const FILE_TMP_PREFIX = ".tmp-"
+
+type File struct {
+	mu   sync.RWMutex
+	path string
+}
+
+type fileTxn struct {
+	f       *File
+	changes map[string][]byte
+}
+
+func OpenFile(path string) (*File, error) {
+	err := os.MkdirAll(path, 0o700)
+	if err != nil {
+		return nil, err
+	}
+	f := &File{path: path}
+	// Finish any update that was interrupted after its journal was
+	// written, then drop files staged by updates that never got that far.
+	err = f.replay()
+	if err != nil {
+		return nil, err
+	}
+	tmps, err := filepath.Glob(filepath.Join(path, FILE_TMP_PREFIX+"*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, tmp := range tmps {
+		os.Remove(tmp)
+	}
+	return f, nil
+}
+
+func (f *File) Has(key []byte) (bool, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.has(key)
+}
+
+func (f *File) Get(key []byte) ([]byte, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.get(key)
+}
+
+func (f *File) Put(key []byte, value []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.put(key, value)
+}
+
+func (f *File) Delete(key []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.delete(key)
+}
+
+func (f *File) Update(fn func(txn Txn) error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	txn := &fileTxn{f: f, changes: map[string][]byte{}}
+	err := fn(txn)
+	if err != nil {
+		return err
+	}
+	return f.commit(txn.changes)
+}
+
+func (f *File) ForEach(fn func(key []byte, value []byte) error) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	entries, err := os.ReadDir(f.path)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		key, err := hex.DecodeString(entry.Name())
+		if err != nil || entry.IsDir() {
+			continue
+		}
+		value, err := f.get(key)
+		if err != nil {
+			return err
+		}
+		err = fn(key, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *File) Close() error {
+	return nil
+}
+
+func (f *File) entryPath(key []byte) string {
+	return filepath.Join(f.path, hex.EncodeToString(key))
+}
+
+func (f *File) has(key []byte) (bool, error) {
+	_, err := os.Stat(f.entryPath(key))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (f *File) get(key []byte) ([]byte, error) {
+	value, err := os.ReadFile(f.entryPath(key))
+	if os.IsNotExist(err) {
+		return []byte{}, ErrNotFound
+	}
+	return value, err
+}
+
+func (f *File) put(key []byte, value []byte) error {
+	tmpPath, err := f.writeTemp(value)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+	return os.Rename(tmpPath, f.entryPath(key))
+}
+
+func (f *File) writeTemp(value []byte) (string, error) {
+	tmp, err := os.CreateTemp(f.path, FILE_TMP_PREFIX)
+	if err != nil {
+		return "", err
+	}
+	_, err = tmp.Write(value)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// commit applies the changes of an update all at once. Every new value is
+// first staged in a temporary file, then a journal listing all changes is
+// renamed into place. Until that rename nothing is visible and the staged
+// files are simply dropped; after it, the journal is replayed, here or on
+// the next open, until every change has been applied.
+func (f *File) commit(changes map[string][]byte) error {
+	// A journal left behind by a failed replay must be finished first,
+	// or the new one would replace it.
+	err := f.replay()
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(changes))
+	for key := range changes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	journal := []string{}
+	staged := []string{}
+	unstage := func() {
+		for _, tmpPath := range staged {
+			os.Remove(tmpPath)
+		}
+	}
+	for _, key := range keys {
+		value := changes[key]
+		if value == nil {
+			journal = append(journal, "delete "+hex.EncodeToString([]byte(key)))
+			continue
+		}
+		tmpPath, err := f.writeTemp(value)
+		if err != nil {
+			unstage()
+			return err
+		}
+		staged = append(staged, tmpPath)
+		journal = append(journal, "put "+hex.EncodeToString([]byte(key))+" "+filepath.Base(tmpPath))
+	}
+	if len(journal) == 0 {
+		return nil
+	}
+	journalTmpPath, err := f.writeTemp([]byte(strings.Join(journal, "\n")))
+	if err == nil {
+		err = os.Rename(journalTmpPath, filepath.Join(f.path, FILE_JOURNAL))
+		if err != nil {
+			os.Remove(journalTmpPath)
+		}
+	}
+	if err == nil {
+		err = f.syncDir()
+	}
+	if err != nil {
+		unstage()
+		return err
+	}
+	return f.replay()
+}
+
+func (f *File) replay() error {
+	journalPath := filepath.Join(f.path, FILE_JOURNAL)
+	journalBytes, err := os.ReadFile(journalPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(journalBytes), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return errors.New("could not decode store journal")
+		}
+		key, err := hex.DecodeString(fields[1])
+		if err != nil {
+			return errors.New("could not decode store journal")
+		}
+		switch {
+		case fields[0] == "put" && len(fields) == 3:
+			// Staged files that are gone were already renamed into place.
+			err = os.Rename(filepath.Join(f.path, filepath.Base(fields[2])), f.entryPath(key))
+			if os.IsNotExist(err) {
+				err = nil
+			}
+		case fields[0] == "delete" && len(fields) == 2:
+			err = f.delete(key)
+		default:
+			return errors.New("could not decode store journal")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	err = f.syncDir()
+	if err != nil {
+		return err
+	}
+	return os.Remove(journalPath)
+}
+
+func (f *File) syncDir() error {
+	dir, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+func (f *File) delete(key []byte) error {
+	err := os.Remove(f.entryPath(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (t *fileTxn) Has(key []byte) (bool, error) {
+	if value, ok := t.changes[string(key)]; ok {
+		return value != nil, nil
+	}
+	return t.f.has(key)
+}
+
+func (t *fileTxn) Get(key []byte) ([]byte, error) {
+	if value, ok := t.changes[string(key)]; ok {
+		if value == nil {
+			return []byte{}, ErrNotFound
+		}
+		return append([]byte{}, value...), nil
+	}
+	return t.f.get(key)
+}
+
+func (t *fileTxn) Put(key []byte, value []byte) error {
+	t.changes[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+func (t *fileTxn) Delete(key []byte) error {
+	t.changes[string(key)] = nil
+	return nil
+}
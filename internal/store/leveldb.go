@@ -0,0 +1,96 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package store
+
+import (
+	"errors"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+type LevelDB struct {
+	db *leveldb.DB
+}
+
+type levelDBTxn struct {
+	tr *leveldb.Transaction
+}
+
+func OpenLevelDB(path string) (*LevelDB, error) {
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &LevelDB{db: db}, nil
+}
+
+func (l *LevelDB) Has(key []byte) (bool, error) {
+	return l.db.Has(key, &opt.ReadOptions{})
+}
+
+func (l *LevelDB) Get(key []byte) ([]byte, error) {
+	value, err := l.db.Get(key, &opt.ReadOptions{})
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return []byte{}, ErrNotFound
+	}
+	return value, err
+}
+
+func (l *LevelDB) Put(key []byte, value []byte) error {
+	return l.db.Put(key, value, &opt.WriteOptions{Sync: true})
+}
+
+func (l *LevelDB) Delete(key []byte) error {
+	return l.db.Delete(key, &opt.WriteOptions{Sync: true})
+}
+
+func (l *LevelDB) Update(fn func(txn Txn) error) error {
+	tr, err := l.db.OpenTransaction()
+	if err != nil {
+		return err
+	}
+	err = fn(&levelDBTxn{tr: tr})
+	if err != nil {
+		tr.Discard()
+		return err
+	}
+	return tr.Commit()
+}
+
+func (l *LevelDB) ForEach(fn func(key []byte, value []byte) error) error {
+	iter := l.db.NewIterator(nil, &opt.ReadOptions{})
+	defer iter.Release()
+	for iter.Next() {
+		err := fn(append([]byte{}, iter.Key()...), append([]byte{}, iter.Value()...))
+		if err != nil {
+			return err
+		}
+	}
+	return iter.Error()
+}
+
+func (l *LevelDB) Close() error {
+	return l.db.Close()
+}
+
+func (t *levelDBTxn) Has(key []byte) (bool, error) {
+	return t.tr.Has(key, &opt.ReadOptions{})
+}
+
+func (t *levelDBTxn) Get(key []byte) ([]byte, error) {
+	value, err := t.tr.Get(key, &opt.ReadOptions{})
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return []byte{}, ErrNotFound
+	}
+	return value, err
+}
+
+func (t *levelDBTxn) Put(key []byte, value []byte) error {
+	return t.tr.Put(key, value, &opt.WriteOptions{Sync: true})
+}
+
+func (t *levelDBTxn) Delete(key []byte) error {
+	return t.tr.Delete(key, &opt.WriteOptions{Sync: true})
+}
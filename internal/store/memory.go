@@ -0,0 +1,120 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package store
+
+import (
+	"sync"
+)
+
+type Memory struct {
+	mu      sync.RWMutex
+	entries map[string][]byte
+}
+
+type memoryTxn struct {
+	entries map[string][]byte
+	changes map[string][]byte
+}
+
+func OpenMemory() *Memory {
+	return &Memory{entries: map[string][]byte{}}
+}
+
+func (m *Memory) Has(key []byte) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.entries[string(key)]
+	return ok, nil
+}
+
+func (m *Memory) Get(key []byte) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	value, ok := m.entries[string(key)]
+	if !ok {
+		return []byte{}, ErrNotFound
+	}
+	return append([]byte{}, value...), nil
+}
+
+func (m *Memory) Put(key []byte, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+func (m *Memory) Delete(key []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, string(key))
+	return nil
+}
+
+func (m *Memory) Update(fn func(txn Txn) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	txn := &memoryTxn{entries: m.entries, changes: map[string][]byte{}}
+	err := fn(txn)
+	if err != nil {
+		return err
+	}
+	for key, value := range txn.changes {
+		if value == nil {
+			delete(m.entries, key)
+		} else {
+			m.entries[key] = value
+		}
+	}
+	return nil
+}
+
+func (m *Memory) ForEach(fn func(key []byte, value []byte) error) error {
+	m.mu.RLock()
+	entries := make(map[string][]byte, len(m.entries))
+	for key, value := range m.entries {
+		entries[key] = value
+	}
+	m.mu.RUnlock()
+	for key, value := range entries {
+		err := fn([]byte(key), append([]byte{}, value...))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
+
+func (t *memoryTxn) Has(key []byte) (bool, error) {
+	if value, ok := t.changes[string(key)]; ok {
+		return value != nil, nil
+	}
+	_, ok := t.entries[string(key)]
+	return ok, nil
+}
+
+func (t *memoryTxn) Get(key []byte) ([]byte, error) {
+	value, ok := t.changes[string(key)]
+	if !ok {
+		value, ok = t.entries[string(key)]
+	}
+	if !ok || value == nil {
+		return []byte{}, ErrNotFound
+	}
+	return append([]byte{}, value...), nil
+}
+
+func (t *memoryTxn) Put(key []byte, value []byte) error {
+	t.changes[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+func (t *memoryTxn) Delete(key []byte) error {
+	t.changes[string(key)] = nil
+	return nil
+}
@@ -0,0 +1,136 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package store
+
+import (
+	"database/sql"
+	"errors"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type SQLite struct {
+	db *sql.DB
+}
+
+type sqliteQuerier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+type sqliteTxn struct {
+	q sqliteQuerier
+}
+
+func OpenSQLite(path string) (*SQLite, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite only allows one writer at a time, so serialize
+	// all access through a single connection.
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS entries (key BLOB PRIMARY KEY, value BLOB NOT NULL)")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLite{db: db}, nil
+}
+
+func (s *SQLite) Has(key []byte) (bool, error) {
+	return (&sqliteTxn{q: s.db}).Has(key)
+}
+
+func (s *SQLite) Get(key []byte) ([]byte, error) {
+	return (&sqliteTxn{q: s.db}).Get(key)
+}
+
+func (s *SQLite) Put(key []byte, value []byte) error {
+	return (&sqliteTxn{q: s.db}).Put(key, value)
+}
+
+func (s *SQLite) Delete(key []byte) error {
+	return (&sqliteTxn{q: s.db}).Delete(key)
+}
+
+func (s *SQLite) Update(fn func(txn Txn) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	err = fn(&sqliteTxn{q: tx})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLite) ForEach(fn func(key []byte, value []byte) error) error {
+	// Entries are read in full first, since the single connection
+	// stays busy until the rows are closed.
+	rows, err := s.db.Query("SELECT key, value FROM entries")
+	if err != nil {
+		return err
+	}
+	var keys, values [][]byte
+	for rows.Next() {
+		var key, value []byte
+		err = rows.Scan(&key, &value)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+	rows.Close()
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+	for i := range keys {
+		err = fn(keys[i], values[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
+
+func (t *sqliteTxn) Has(key []byte) (bool, error) {
+	var n int
+	err := t.q.QueryRow("SELECT COUNT(*) FROM entries WHERE key = ?", key).Scan(&n)
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (t *sqliteTxn) Get(key []byte) ([]byte, error) {
+	var value []byte
+	err := t.q.QueryRow("SELECT value FROM entries WHERE key = ?", key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return []byte{}, ErrNotFound
+	}
+	if err != nil {
+		return []byte{}, err
+	}
+	return value, nil
+}
+
+func (t *sqliteTxn) Put(key []byte, value []byte) error {
+	_, err := t.q.Exec("INSERT OR REPLACE INTO entries (key, value) VALUES (?, ?)", key, value)
+	return err
+}
+
+func (t *sqliteTxn) Delete(key []byte) error {
+	_, err := t.q.Exec("DELETE FROM entries WHERE key = ?", key)
+	return err
+}
@@ -4,32 +4,34 @@
 package store
 
 import (
+	"bytes"
 	"errors"
-	"log"
-
-	"github.com/syndtr/goleveldb/leveldb"
-	"github.com/syndtr/goleveldb/leveldb/opt"
 
 	"google.golang.org/protobuf/proto"
 
+	"github.com/symbolicsoft/enclave/v2/internal/ciphers"
 	enclaveProto "github.com/symbolicsoft/enclave/v2/internal/proto"
 )
 
-var Database = func() *leveldb.DB {
-	db, err := leveldb.OpenFile("enclave.db", nil)
-	if err != nil {
-		log.Fatal("could not open database")
-	}
-	return db
-}()
+// Decoy links map a notebook to the decoy notebook pointing at it.
+// The prefix keeps them apart from notebook identifiers.
+const DECOY_LINK_PREFIX = "decoy:"
+
+// Tombstones mark notebook identifiers that were deleted or re-keyed, so
+// that stale clients cannot bring them back.
+const TOMBSTONE_PREFIX = "tombstone:"
 
-func HasNotebook(notebookId []byte) (bool, error) {
-	return Database.Has(notebookId, &opt.ReadOptions{})
+// DECOY_LINKS_BACKFILLED marks stores whose decoy links were rebuilt for
+// decoys linked before decoy links were recorded.
+const DECOY_LINKS_BACKFILLED = "meta:decoy-links-backfilled"
+
+func HasNotebook(txn Txn, notebookId []byte) (bool, error) {
+	return txn.Has(notebookId)
 }
 
-func PutNotebook(notebookId []byte, entry *enclaveProto.EncryptedNotebook, overwrite bool) error {
+func PutNotebook(txn Txn, notebookId []byte, entry *enclaveProto.EncryptedNotebook, overwrite bool) error {
 	var entryBytes []byte
-	has, err := HasNotebook(notebookId)
+	has, err := HasNotebook(txn, notebookId)
 	if err != nil {
 		return err
 	}
@@ -40,11 +42,11 @@ func PutNotebook(notebookId []byte, entry *enclaveProto.EncryptedNotebook, overw
 	if err != nil {
 		return err
 	}
-	return Database.Put(notebookId, entryBytes, &opt.WriteOptions{Sync: true})
+	return txn.Put(notebookId, entryBytes)
 }
 
-func GetNotebook(notebookId []byte) (*enclaveProto.EncryptedNotebook, error) {
-	entryBytes, err := Database.Get(notebookId, &opt.ReadOptions{})
+func GetNotebook(txn Txn, notebookId []byte) (*enclaveProto.EncryptedNotebook, error) {
+	entryBytes, err := txn.Get(notebookId)
 	if err != nil {
 		return &enclaveProto.EncryptedNotebook{}, err
 	}
@@ -56,13 +58,86 @@ func GetNotebook(notebookId []byte) (*enclaveProto.EncryptedNotebook, error) {
 	return entry, err
 }
 
-func DeleteNotebook(notebookId []byte) error {
-	return Database.Delete(notebookId, &opt.WriteOptions{Sync: true})
+func DeleteNotebook(txn Txn, notebookId []byte) error {
+	return txn.Delete(notebookId)
 }
 
-func CloseDatabase() {
-	err := Database.Close()
+// RemoveNotebook deletes a notebook and leaves a tombstone in its place.
+func RemoveNotebook(txn Txn, notebookId []byte) error {
+	err := txn.Put(tombstoneKey(notebookId), []byte{1})
 	if err != nil {
-		log.Fatal("could not close database")
+		return err
 	}
+	return DeleteNotebook(txn, notebookId)
+}
+
+func HasTombstone(txn Txn, notebookId []byte) (bool, error) {
+	return txn.Has(tombstoneKey(notebookId))
+}
+
+func GetDecoyLink(txn Txn, notebookId []byte) ([]byte, error) {
+	return txn.Get(decoyLinkKey(notebookId))
+}
+
+func PutDecoyLink(txn Txn, notebookId []byte, decoyId []byte) error {
+	return txn.Put(decoyLinkKey(notebookId), decoyId)
+}
+
+func DeleteDecoyLink(txn Txn, notebookId []byte) error {
+	return txn.Delete(decoyLinkKey(notebookId))
+}
+
+// BackfillDecoyLinks records the decoy link of every decoy notebook that
+// was linked before decoy links were recorded, so that deleting or
+// re-keying the notebooks they point at keeps them consistent. It only
+// scans the store once.
+func BackfillDecoyLinks(b Backend) error {
+	done, err := b.Has([]byte(DECOY_LINKS_BACKFILLED))
+	if err != nil || done {
+		return err
+	}
+	links := map[string][]byte{}
+	err = b.ForEach(func(key []byte, value []byte) error {
+		if len(key) != ciphers.SUBKEY_L {
+			return nil
+		}
+		entry := &enclaveProto.EncryptedNotebook{}
+		if proto.Unmarshal(value, entry) != nil || len(entry.DecoyFor) != ciphers.SUBKEY_L {
+			return nil
+		}
+		links[string(entry.DecoyFor)] = key
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return b.Update(func(txn Txn) error {
+		for notebookId, decoyId := range links {
+			// Links recorded since are authoritative.
+			_, err := GetDecoyLink(txn, []byte(notebookId))
+			if err == nil {
+				continue
+			}
+			if !errors.Is(err, ErrNotFound) {
+				return err
+			}
+			decoy, err := GetNotebook(txn, decoyId)
+			if err != nil || !bytes.Equal(decoy.DecoyFor, []byte(notebookId)) {
+				continue
+			}
+			err = PutDecoyLink(txn, []byte(notebookId), decoyId)
+			if err != nil {
+				return err
+			}
+		}
+		return txn.Put([]byte(DECOY_LINKS_BACKFILLED), []byte{1})
+	})
+}
+
+func decoyLinkKey(notebookId []byte) []byte {
+	return append([]byte(DECOY_LINK_PREFIX), notebookId...)
+}
+
+func tombstoneKey(notebookId []byte) []byte {
+	return append([]byte(TOMBSTONE_PREFIX), notebookId...)
 }
@@ -0,0 +1,277 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package store
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/symbolicsoft/enclave/v2/internal/ciphers"
+	enclaveProto "github.com/symbolicsoft/enclave/v2/internal/proto"
+)
+
+var errAbort = errors.New("abort")
+
+func openBackends(t *testing.T) map[string]func() Backend {
+	dir := t.TempDir()
+	backends := map[string]func() Backend{}
+	for _, backend := range BACKENDS {
+		backend := backend
+		path := filepath.Join(dir, backend)
+		if backend == BACKEND_SQLITE {
+			path += ".db"
+		}
+		var memory Backend
+		backends[backend] = func() Backend {
+			if backend == BACKEND_MEMORY {
+				if memory == nil {
+					memory = OpenMemory()
+				}
+				return memory
+			}
+			b, err := Open(backend, path)
+			if err != nil {
+				t.Fatalf("%s: %v", backend, err)
+			}
+			return b
+		}
+	}
+	return backends
+}
+
+func forEachBackend(t *testing.T, test func(t *testing.T, open func() Backend)) {
+	for backend, open := range openBackends(t) {
+		open := open
+		t.Run(backend, func(t *testing.T) {
+			test(t, open)
+		})
+	}
+}
+
+func expectValue(t *testing.T, txn Txn, key string, value string) {
+	t.Helper()
+	got, err := txn.Get([]byte(key))
+	if err != nil {
+		t.Fatalf("get %q: %v", key, err)
+	}
+	if !bytes.Equal(got, []byte(value)) {
+		t.Fatalf("get %q: got %q, want %q", key, got, value)
+	}
+	has, err := txn.Has([]byte(key))
+	if err != nil || !has {
+		t.Fatalf("has %q: got %v, %v", key, has, err)
+	}
+}
+
+func expectMissing(t *testing.T, txn Txn, key string) {
+	t.Helper()
+	_, err := txn.Get([]byte(key))
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("get %q: got %v, want ErrNotFound", key, err)
+	}
+	has, err := txn.Has([]byte(key))
+	if err != nil || has {
+		t.Fatalf("has %q: got %v, %v", key, has, err)
+	}
+}
+
+func TestBackendPutGetDelete(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, open func() Backend) {
+		b := open()
+		defer b.Close()
+		expectMissing(t, b, "a")
+		if err := b.Put([]byte("a"), []byte("1")); err != nil {
+			t.Fatal(err)
+		}
+		expectValue(t, b, "a", "1")
+		if err := b.Put([]byte("a"), []byte("2")); err != nil {
+			t.Fatal(err)
+		}
+		expectValue(t, b, "a", "2")
+		if err := b.Delete([]byte("a")); err != nil {
+			t.Fatal(err)
+		}
+		expectMissing(t, b, "a")
+		if err := b.Delete([]byte("a")); err != nil {
+			t.Fatalf("deleting a missing entry: %v", err)
+		}
+	})
+}
+
+func TestBackendUpdateCommits(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, open func() Backend) {
+		b := open()
+		defer b.Close()
+		b.Put([]byte("old"), []byte("1"))
+		err := b.Update(func(txn Txn) error {
+			if err := txn.Put([]byte("new"), []byte("2")); err != nil {
+				return err
+			}
+			if err := txn.Delete([]byte("old")); err != nil {
+				return err
+			}
+			// Reads within an update see its own writes.
+			expectValue(t, txn, "new", "2")
+			expectMissing(t, txn, "old")
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectValue(t, b, "new", "2")
+		expectMissing(t, b, "old")
+	})
+}
+
+func TestBackendUpdateRollsBack(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, open func() Backend) {
+		b := open()
+		defer b.Close()
+		b.Put([]byte("old"), []byte("1"))
+		err := b.Update(func(txn Txn) error {
+			txn.Put([]byte("new"), []byte("2"))
+			txn.Put([]byte("old"), []byte("3"))
+			txn.Delete([]byte("old"))
+			return errAbort
+		})
+		if !errors.Is(err, errAbort) {
+			t.Fatalf("got %v, want errAbort", err)
+		}
+		expectValue(t, b, "old", "1")
+		expectMissing(t, b, "new")
+	})
+}
+
+func TestBackendPersists(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, open func() Backend) {
+		b := open()
+		b.Update(func(txn Txn) error {
+			txn.Put([]byte("a"), []byte("1"))
+			return txn.Put([]byte("b"), []byte("2"))
+		})
+		if err := b.Close(); err != nil {
+			t.Fatal(err)
+		}
+		b = open()
+		defer b.Close()
+		expectValue(t, b, "a", "1")
+		expectValue(t, b, "b", "2")
+	})
+}
+
+func TestBackendForEach(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, open func() Backend) {
+		b := open()
+		defer b.Close()
+		want := map[string]string{"a": "1", "b": "2", "c": "3"}
+		for key, value := range want {
+			b.Put([]byte(key), []byte(value))
+		}
+		b.Delete([]byte("c"))
+		delete(want, "c")
+		got := map[string]string{}
+		err := b.ForEach(func(key []byte, value []byte) error {
+			got[string(key)] = string(value)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(want) || got["a"] != want["a"] || got["b"] != want["b"] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+		err = b.ForEach(func(key []byte, value []byte) error {
+			return errAbort
+		})
+		if !errors.Is(err, errAbort) {
+			t.Fatalf("got %v, want errAbort", err)
+		}
+	})
+}
+
+func TestBackfillDecoyLinks(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, open func() Backend) {
+		b := open()
+		defer b.Close()
+		realId := bytes.Repeat([]byte{1}, ciphers.SUBKEY_L)
+		decoyId := bytes.Repeat([]byte{2}, ciphers.SUBKEY_L)
+		linkedId := bytes.Repeat([]byte{3}, ciphers.SUBKEY_L)
+		linkedDecoyId := bytes.Repeat([]byte{4}, ciphers.SUBKEY_L)
+		b.Update(func(txn Txn) error {
+			PutNotebook(txn, realId, &enclaveProto.EncryptedNotebook{NotebookId: realId}, true)
+			PutNotebook(txn, decoyId, &enclaveProto.EncryptedNotebook{NotebookId: decoyId, DecoyFor: realId}, true)
+			PutNotebook(txn, linkedId, &enclaveProto.EncryptedNotebook{NotebookId: linkedId}, true)
+			PutNotebook(txn, linkedDecoyId, &enclaveProto.EncryptedNotebook{NotebookId: linkedDecoyId, DecoyFor: linkedId}, true)
+			return PutDecoyLink(txn, linkedId, decoyId)
+		})
+		if err := BackfillDecoyLinks(b); err != nil {
+			t.Fatal(err)
+		}
+		link, err := GetDecoyLink(b, realId)
+		if err != nil || !bytes.Equal(link, decoyId) {
+			t.Fatalf("got decoy link %x, %v, want %x", link, err, decoyId)
+		}
+		link, err = GetDecoyLink(b, linkedId)
+		if err != nil || !bytes.Equal(link, decoyId) {
+			t.Fatalf("existing decoy link was replaced with %x, %v", link, err)
+		}
+		DeleteDecoyLink(b, realId)
+		if err := BackfillDecoyLinks(b); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := GetDecoyLink(b, realId); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("decoy links were backfilled twice: %v", err)
+		}
+	})
+}
+
+func TestFileReplaysJournal(t *testing.T) {
+	dir := t.TempDir()
+	f, err := OpenFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Put([]byte("old"), []byte("1"))
+	// Simulate a crash after the journal was written but before any of
+	// its changes were applied.
+	staged, err := f.writeTemp([]byte("2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal := "put " + hex.EncodeToString([]byte("new")) + " " + filepath.Base(staged) + "\n" +
+		"delete " + hex.EncodeToString([]byte("old"))
+	os.WriteFile(filepath.Join(dir, FILE_JOURNAL), []byte(journal), 0o600)
+	f, err = OpenFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectValue(t, f, "new", "2")
+	expectMissing(t, f, "old")
+	if _, err := os.Stat(filepath.Join(dir, FILE_JOURNAL)); !os.IsNotExist(err) {
+		t.Fatalf("journal was not removed: %v", err)
+	}
+}
+
+func TestFileDropsUncommittedStaging(t *testing.T) {
+	dir := t.TempDir()
+	f, err := OpenFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Simulate a crash while values were still being staged.
+	if _, err := f.writeTemp([]byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = OpenFile(dir); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Fatalf("got %d leftover files, want none", len(entries))
+	}
+}
@@ -0,0 +1,43 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package tui
+
+import (
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/huh"
+)
+
+type DialogModel struct {
+	form   *huh.Form
+	action func(mm *MainModel) tea.Cmd
+}
+
+func (dm DialogModel) Construct(form *huh.Form, width int, action func(mm *MainModel) tea.Cmd) DialogModel {
+	return DialogModel{
+		form:   form.WithTheme(huh.ThemeBase16()).WithWidth(width),
+		action: action,
+	}
+}
+
+func (dm DialogModel) Init() tea.Cmd {
+	return dm.form.Init()
+}
+
+func (dm DialogModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	formNew, cmd := dm.form.Update(msg)
+	dm.form = formNew.(*huh.Form)
+	return dm, cmd
+}
+
+func (dm DialogModel) View() string {
+	return dm.form.View()
+}
+
+func (dm DialogModel) Completed() bool {
+	return dm.form.State == huh.StateCompleted
+}
+
+func (dm DialogModel) Aborted() bool {
+	return dm.form.State == huh.StateAborted
+}
@@ -0,0 +1,309 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package tui
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	findMatchStyle = lipgloss.NewStyle().
+			Background(lipgloss.Color("#5a5a00"))
+	findCurrentStyle = lipgloss.NewStyle().
+				Background(lipgloss.Color("#34beed")).
+				Foreground(lipgloss.Color("#000000"))
+)
+
+type FindModel struct {
+	findInput     textinput.Model
+	replaceInput  textinput.Model
+	replacing     bool
+	confirming    bool
+	caseSensitive bool
+	body          string
+	matches       [][]int
+	current       int
+	origin        int
+	changed       bool
+	status        string
+	width         int
+	height        int
+}
+
+func (fm FindModel) Construct(body string, origin int, width int, height int) FindModel {
+	fi := textinput.New()
+	fi.Prompt = "Find: "
+	fi.Focus()
+	ri := textinput.New()
+	ri.Prompt = "Replace with: "
+	return FindModel{
+		findInput:    fi,
+		replaceInput: ri,
+		body:         body,
+		matches:      [][]int{},
+		origin:       origin,
+		width:        width,
+		height:       height,
+	}
+}
+
+func (fm FindModel) Init() tea.Cmd {
+	return textinput.Blink
+}
+
+func (fm FindModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	msgKey, ok := msg.(tea.KeyMsg)
+	if ok && fm.confirming {
+		fm.updateConfirm(msgKey)
+		return fm, nil
+	}
+	if ok {
+		switch msgKey.String() {
+		case "enter":
+			if fm.replacing && fm.replaceInput.Focused() && len(fm.matches) > 0 {
+				fm.confirming = true
+				fm.status = ""
+				return fm, nil
+			}
+			fm.next()
+			return fm, nil
+		case "down", "ctrl+n":
+			fm.next()
+			return fm, nil
+		case "up", "ctrl+p":
+			fm.previous()
+			return fm, nil
+		case "tab":
+			if fm.replacing {
+				if fm.findInput.Focused() {
+					fm.findInput.Blur()
+					cmd = fm.replaceInput.Focus()
+				} else {
+					fm.replaceInput.Blur()
+					cmd = fm.findInput.Focus()
+				}
+			}
+			return fm, cmd
+		case "ctrl+r":
+			fm.replacing = !fm.replacing
+			if fm.replacing {
+				fm.findInput.Blur()
+				cmd = fm.replaceInput.Focus()
+			} else {
+				fm.replaceInput.Blur()
+				cmd = fm.findInput.Focus()
+			}
+			return fm, cmd
+		case "ctrl+a":
+			if fm.replacing && len(fm.matches) > 0 {
+				fm.replaceFrom(0)
+			}
+			return fm, nil
+		case "ctrl+t":
+			fm.caseSensitive = !fm.caseSensitive
+			fm.find()
+			return fm, nil
+		}
+	}
+	query := fm.findInput.Value()
+	fm.findInput, cmd = fm.findInput.Update(msg)
+	if query != fm.findInput.Value() {
+		fm.status = ""
+		fm.find()
+	}
+	var cmdReplace tea.Cmd
+	fm.replaceInput, cmdReplace = fm.replaceInput.Update(msg)
+	return fm, tea.Batch(cmd, cmdReplace)
+}
+
+func (fm *FindModel) updateConfirm(msg tea.KeyMsg) {
+	switch msg.String() {
+	case "y":
+		start := fm.matches[fm.current][0]
+		fm.replace(fm.current)
+		fm.origin = start + len(fm.replaceInput.Value())
+		fm.find()
+		if len(fm.matches) == 0 || fm.matches[fm.current][0] < fm.origin {
+			fm.confirming = false
+		}
+	case "n":
+		if fm.current == len(fm.matches)-1 {
+			fm.confirming = false
+		} else {
+			fm.current++
+		}
+	case "a":
+		fm.replaceFrom(fm.current)
+		fm.confirming = false
+	case "q", "esc":
+		fm.confirming = false
+	}
+}
+
+func (fm FindModel) View() string {
+	bar := []string{fm.findInput.View()}
+	if fm.replacing {
+		bar = append(bar, fm.replaceInput.View())
+	}
+	status := fm.status
+	switch {
+	case fm.confirming:
+		status = "Replace this match? y: yes • n: no • a: all remaining • q: stop"
+	case len(status) > 0:
+	case len(fm.findInput.Value()) == 0:
+	case len(fm.matches) == 0:
+		status = "No matches."
+	default:
+		status = fmt.Sprintf("Match %d of %d.", fm.current+1, len(fm.matches))
+	}
+	help := fmt.Sprintf("enter: next • ↑: previous • ctrl+t: case-sensitive %s • ctrl+r: replace • esc: close", onOff(fm.caseSensitive))
+	if fm.replacing {
+		help = "tab: switch field • enter in replace: confirm each • ctrl+a: replace all • esc: close"
+	}
+	bar = append(bar, truncateRunes(status, fm.width), searchDimStyle.Render(truncateRunes(help, fm.width)))
+	return lipgloss.JoinVertical(lipgloss.Left, fm.bodyView(fm.height-len(bar)), strings.Join(bar, "\n"))
+}
+
+func (fm FindModel) Position() (int, int, bool) {
+	if len(fm.matches) == 0 {
+		return 0, 0, false
+	}
+	before := fm.body[:fm.matches[fm.current][0]]
+	line := strings.Count(before, "\n")
+	col := utf8.RuneCountInString(before[strings.LastIndex(before, "\n")+1:])
+	return line, col, true
+}
+
+func (fm *FindModel) find() {
+	fm.matches = [][]int{}
+	fm.current = 0
+	query := fm.findInput.Value()
+	if len(query) == 0 {
+		return
+	}
+	query = regexp.QuoteMeta(query)
+	if !fm.caseSensitive {
+		query = "(?i)" + query
+	}
+	re, err := regexp.Compile(query)
+	if err != nil {
+		return
+	}
+	fm.matches = re.FindAllStringIndex(fm.body, -1)
+	for i, match := range fm.matches {
+		if match[0] >= fm.origin {
+			fm.current = i
+			break
+		}
+	}
+}
+
+func (fm *FindModel) next() {
+	if len(fm.matches) > 0 {
+		fm.current = (fm.current + 1) % len(fm.matches)
+		fm.origin = fm.matches[fm.current][0]
+		fm.status = ""
+	}
+}
+
+func (fm *FindModel) previous() {
+	if len(fm.matches) > 0 {
+		fm.current = (fm.current + len(fm.matches) - 1) % len(fm.matches)
+		fm.origin = fm.matches[fm.current][0]
+		fm.status = ""
+	}
+}
+
+func (fm *FindModel) replace(index int) {
+	match := fm.matches[index]
+	fm.body = fm.body[:match[0]] + fm.replaceInput.Value() + fm.body[match[1]:]
+	fm.changed = true
+}
+
+func (fm *FindModel) replaceFrom(index int) {
+	replaced := len(fm.matches) - index
+	for i := len(fm.matches) - 1; i >= index; i-- {
+		fm.replace(i)
+	}
+	fm.origin = fm.matches[index][0]
+	fm.find()
+	fm.status = fmt.Sprintf("Replaced %d matches.", replaced)
+}
+
+func (fm FindModel) bodyView(height int) string {
+	style, _ := textarea.DefaultStyles()
+	prompt := style.Prompt.Render(lipgloss.ThickBorder().Left + " ")
+	width := max(fm.width, 1)
+	rows := []string{}
+	currentRow := 0
+	offset := 0
+	for lineIndex, line := range strings.Split(fm.body, "\n") {
+		runes := []rune(line)
+		classes := make([]int, len(runes))
+		for i, match := range fm.matches {
+			if match[1] <= offset || match[0] > offset+len(line) {
+				continue
+			}
+			class := 1
+			if i == fm.current {
+				class = 2
+			}
+			start := utf8.RuneCountInString(line[:max(match[0]-offset, 0)])
+			end := utf8.RuneCountInString(line[:min(match[1]-offset, len(line))])
+			for r := start; r < end; r++ {
+				classes[r] = class
+			}
+			if i == fm.current {
+				currentRow = len(rows) + start/width
+			}
+		}
+		for chunk := 0; chunk == 0 || chunk*width < len(runes); chunk++ {
+			lineNumber := style.LineNumber.Render(fmt.Sprintf("%2v ", lineIndex+1))
+			if chunk > 0 {
+				lineNumber = "   "
+			}
+			end := min((chunk+1)*width, len(runes))
+			rows = append(rows, prompt+lineNumber+renderClasses(runes[chunk*width:end], classes[chunk*width:end]))
+		}
+		offset += len(line) + 1
+	}
+	first := 0
+	if len(rows) > height {
+		first = min(max(currentRow-height/2, 0), len(rows)-height)
+	}
+	rows = rows[first:min(first+max(height, 0), len(rows))]
+	for len(rows) < height {
+		rows = append(rows, prompt+style.EndOfBuffer.Render(fmt.Sprintf("%2v ", "~")))
+	}
+	return strings.Join(rows, "\n")
+}
+
+func renderClasses(runes []rune, classes []int) string {
+	var s strings.Builder
+	for start := 0; start < len(runes); {
+		end := start
+		for end < len(runes) && classes[end] == classes[start] {
+			end++
+		}
+		switch classes[start] {
+		case 1:
+			s.WriteString(findMatchStyle.Render(string(runes[start:end])))
+		case 2:
+			s.WriteString(findCurrentStyle.Render(string(runes[start:end])))
+		default:
+			s.WriteString(string(runes[start:end]))
+		}
+		start = end
+	}
+	return s.String()
+}
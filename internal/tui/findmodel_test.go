@@ -0,0 +1,108 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package tui
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func newFind(body string, origin int, query string, replacement string) FindModel {
+	fm := FindModel{}.Construct(body, origin, 80, 20)
+	fm.findInput.SetValue(query)
+	fm.replaceInput.SetValue(replacement)
+	fm.replacing = true
+	fm.find()
+	return fm
+}
+
+func keyMsg(s string) tea.KeyMsg {
+	if s == "esc" {
+		return tea.KeyMsg{Type: tea.KeyEsc}
+	}
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)}
+}
+
+func TestFindReplaceFrom(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		body        string
+		query       string
+		replacement string
+		from        int
+		want        string
+		status      string
+	}{
+		{"all", "cat Cat CAT", "cat", "dog", 0, "dog dog dog", "Replaced 3 matches."},
+		{"remaining", "cat cat cat", "cat", "dog", 1, "cat dog dog", "Replaced 2 matches."},
+		{"containing the query", "cat cat", "cat", "cats", 0, "cats cats", "Replaced 2 matches."},
+		{"multi-byte", "héllo wörld héllo", "HÉLLO", "hi", 0, "hi wörld hi", "Replaced 2 matches."},
+		{"deleting", "a-b-c", "-", "", 0, "abc", "Replaced 2 matches."},
+	} {
+		fm := newFind(tc.body, 0, tc.query, tc.replacement)
+		fm.replaceFrom(tc.from)
+		if fm.body != tc.want || fm.status != tc.status || !fm.changed {
+			t.Fatalf("%s: got %q (%q), want %q (%q)", tc.name, fm.body, fm.status, tc.want, tc.status)
+		}
+	}
+}
+
+func TestFindConfirm(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		body        string
+		origin      int
+		query       string
+		replacement string
+		keys        []string
+		want        string
+		confirming  bool
+	}{
+		{"yes to all", "cat cat cat", 0, "cat", "dog", []string{"y", "y", "y"}, "dog dog dog", false},
+		{"skip", "cat cat cat", 0, "cat", "dog", []string{"n", "y"}, "cat dog cat", true},
+		{"no at the last match", "cat cat", 0, "cat", "dog", []string{"n", "n"}, "cat cat", false},
+		{"all remaining", "cat cat cat", 0, "cat", "dog", []string{"n", "a"}, "cat dog dog", false},
+		{"stop", "cat cat", 0, "cat", "dog", []string{"y", "q"}, "dog cat", false},
+		{"escape", "cat cat", 0, "cat", "dog", []string{"esc"}, "cat cat", false},
+		// Replacements are not matched again, and confirming stops once
+		// every match after the starting point was replaced.
+		{"containing the query", "cat cat cat", 0, "cat", "cats", []string{"y", "y", "y"}, "cats cats cats", false},
+		{"from the middle", "cat cat cat", 4, "cat", "cats", []string{"y", "y"}, "cat cats cats", false},
+		{"multi-byte", "é cat é cat", 0, "CAT", "chat", []string{"y", "y"}, "é chat é chat", false},
+	} {
+		fm := newFind(tc.body, tc.origin, tc.query, tc.replacement)
+		fm.confirming = true
+		for _, k := range tc.keys {
+			if !fm.confirming {
+				t.Fatalf("%s: stopped confirming before %q", tc.name, k)
+			}
+			fm.updateConfirm(keyMsg(k))
+		}
+		if fm.body != tc.want || fm.confirming != tc.confirming {
+			t.Fatalf("%s: got %q (confirming %v), want %q (confirming %v)", tc.name, fm.body, fm.confirming, tc.want, tc.confirming)
+		}
+	}
+}
+
+func TestFindPosition(t *testing.T) {
+	fm := newFind("héllo\nwörld cat", 0, "cat", "")
+	line, col, ok := fm.Position()
+	if !ok || line != 1 || col != 6 {
+		t.Fatalf("got %d:%d (%v), want 1:6", line, col, ok)
+	}
+	fm = newFind("cat one cat two cat", 5, "cat", "")
+	if fm.current != 1 {
+		t.Fatalf("got current match %d, want the first after the origin", fm.current)
+	}
+	fm.next()
+	fm.next()
+	if fm.current != 0 {
+		t.Fatalf("got current match %d after wrapping, want 0", fm.current)
+	}
+	fm.previous()
+	if fm.current != 2 {
+		t.Fatalf("got current match %d after wrapping back, want 2", fm.current)
+	}
+}
@@ -0,0 +1,116 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package tui
+
+import (
+	"time"
+
+	enclaveProto "github.com/symbolicsoft/enclave/v2/internal/proto"
+)
+
+const HISTORY_MAX = 200
+const HISTORY_COALESCE = time.Second
+
+type history struct {
+	pages     map[*enclaveProto.Page]*pageHistory
+	deleted   []deletedPage
+	undeleted []deletedPage
+}
+
+type pageHistory struct {
+	undo     []string
+	redo     []string
+	lastKind string
+	lastEdit time.Time
+}
+
+type deletedPage struct {
+	page  *enclaveProto.Page
+	index int
+}
+
+func newHistory() *history {
+	return &history{
+		pages:     map[*enclaveProto.Page]*pageHistory{},
+		deleted:   []deletedPage{},
+		undeleted: []deletedPage{},
+	}
+}
+
+func (h *history) page(page *enclaveProto.Page) *pageHistory {
+	ph, ok := h.pages[page]
+	if !ok {
+		ph = &pageHistory{undo: []string{}, redo: []string{}}
+		h.pages[page] = ph
+	}
+	return ph
+}
+
+// record saves the body of a page from before an edit. Consecutive edits of
+// the same non-empty kind made in quick succession are undone together.
+func (h *history) record(page *enclaveProto.Page, previous string, kind string) {
+	ph := h.page(page)
+	now := time.Now()
+	if len(kind) == 0 || kind != ph.lastKind || now.Sub(ph.lastEdit) >= HISTORY_COALESCE || len(ph.undo) == 0 {
+		ph.undo = append(ph.undo, previous)
+		if len(ph.undo) > HISTORY_MAX {
+			ph.undo = ph.undo[len(ph.undo)-HISTORY_MAX:]
+		}
+	}
+	ph.lastKind = kind
+	ph.lastEdit = now
+	ph.redo = []string{}
+}
+
+func (h *history) undo(page *enclaveProto.Page) (string, bool) {
+	ph := h.page(page)
+	if len(ph.undo) == 0 {
+		return "", false
+	}
+	body := ph.undo[len(ph.undo)-1]
+	ph.undo = ph.undo[:len(ph.undo)-1]
+	ph.redo = append(ph.redo, page.Body)
+	ph.lastKind = ""
+	return body, true
+}
+
+func (h *history) redo(page *enclaveProto.Page) (string, bool) {
+	ph := h.page(page)
+	if len(ph.redo) == 0 {
+		return "", false
+	}
+	body := ph.redo[len(ph.redo)-1]
+	ph.redo = ph.redo[:len(ph.redo)-1]
+	ph.undo = append(ph.undo, page.Body)
+	ph.lastKind = ""
+	return body, true
+}
+
+func (h *history) deletePage(page *enclaveProto.Page, index int) {
+	h.deleted = append(h.deleted, deletedPage{page, index})
+	if len(h.deleted) > HISTORY_MAX {
+		h.deleted = h.deleted[len(h.deleted)-HISTORY_MAX:]
+	}
+	h.undeleted = []deletedPage{}
+}
+
+func (h *history) undoDelete() (deletedPage, bool) {
+	if len(h.deleted) == 0 {
+		return deletedPage{}, false
+	}
+	dp := h.deleted[len(h.deleted)-1]
+	h.deleted = h.deleted[:len(h.deleted)-1]
+	h.undeleted = append(h.undeleted, dp)
+	return dp, true
+}
+
+func (h *history) redoDelete() (deletedPage, bool) {
+	if len(h.undeleted) == 0 {
+		return deletedPage{}, false
+	}
+	dp := h.undeleted[len(h.undeleted)-1]
+	h.undeleted = h.undeleted[:len(h.undeleted)-1]
+	h.deleted = append(h.deleted, dp)
+	return dp, true
+}
@@ -0,0 +1,105 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package tui
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	enclaveProto "github.com/symbolicsoft/enclave/v2/internal/proto"
+)
+
+// edit records an edit of page and applies it.
+func edit(h *history, page *enclaveProto.Page, body string, kind string) {
+	h.record(page, page.Body, kind)
+	page.Body = body
+}
+
+func expectBody(t *testing.T, name string, body string, ok bool, want string, wantOk bool) {
+	t.Helper()
+	if body != want || ok != wantOk {
+		t.Fatalf("%s: got %q (%v), want %q (%v)", name, body, ok, want, wantOk)
+	}
+}
+
+func TestHistoryUndoRedo(t *testing.T) {
+	h := newHistory()
+	page := &enclaveProto.Page{Body: "a"}
+	body, ok := h.undo(page)
+	expectBody(t, "undo without history", body, ok, "", false)
+	edit(h, page, "ab", "insert")
+	edit(h, page, "abc", "insert")
+	edit(h, page, "ab", "delete")
+	body, ok = h.undo(page)
+	expectBody(t, "undo delete", body, ok, "abc", true)
+	page.Body = body
+	// Quick edits of the same kind are undone together.
+	body, ok = h.undo(page)
+	expectBody(t, "undo inserts", body, ok, "a", true)
+	page.Body = body
+	body, ok = h.undo(page)
+	expectBody(t, "undo past the start", body, ok, "", false)
+	body, ok = h.redo(page)
+	expectBody(t, "redo inserts", body, ok, "abc", true)
+	page.Body = body
+	// A new edit clears the redo history.
+	edit(h, page, "abcd", "insert")
+	body, ok = h.redo(page)
+	expectBody(t, "redo after an edit", body, ok, "", false)
+	// Edits are not coalesced across pages, kinds or pauses.
+	other := &enclaveProto.Page{Body: "x"}
+	edit(h, other, "xy", "insert")
+	body, ok = h.undo(other)
+	expectBody(t, "undo on another page", body, ok, "x", true)
+	h.page(page).lastEdit = time.Now().Add(-HISTORY_COALESCE)
+	edit(h, page, "abcde", "insert")
+	body, ok = h.undo(page)
+	expectBody(t, "undo after a pause", body, ok, "abcd", true)
+	page.Body = body
+	edit(h, page, "abcd!", "")
+	edit(h, page, "abcd!!", "")
+	body, ok = h.undo(page)
+	expectBody(t, "undo an uncoalesced edit", body, ok, "abcd!", true)
+}
+
+func TestHistoryBounds(t *testing.T) {
+	h := newHistory()
+	page := &enclaveProto.Page{Body: "0"}
+	for i := 1; i <= HISTORY_MAX+10; i++ {
+		edit(h, page, fmt.Sprint(i), "")
+	}
+	if len(h.page(page).undo) != HISTORY_MAX {
+		t.Fatalf("got %d undo steps, want %d", len(h.page(page).undo), HISTORY_MAX)
+	}
+	for i := HISTORY_MAX + 9; i >= 10; i-- {
+		body, ok := h.undo(page)
+		expectBody(t, "undo", body, ok, fmt.Sprint(i), true)
+		page.Body = body
+	}
+	body, ok := h.undo(page)
+	expectBody(t, "undo past the oldest step", body, ok, "", false)
+	for i := 0; i < HISTORY_MAX+10; i++ {
+		h.deletePage(&enclaveProto.Page{Body: fmt.Sprint(i)}, i)
+	}
+	if len(h.deleted) != HISTORY_MAX {
+		t.Fatalf("got %d deleted pages, want %d", len(h.deleted), HISTORY_MAX)
+	}
+	dp, ok := h.undoDelete()
+	if !ok || dp.page.Body != fmt.Sprint(HISTORY_MAX+9) || dp.index != HISTORY_MAX+9 {
+		t.Fatalf("undo delete: got %v (%v)", dp, ok)
+	}
+	dp, ok = h.redoDelete()
+	if !ok || dp.page.Body != fmt.Sprint(HISTORY_MAX+9) {
+		t.Fatalf("redo delete: got %v (%v)", dp, ok)
+	}
+	if _, ok := h.redoDelete(); ok {
+		t.Fatal("redid a delete twice")
+	}
+	h.undoDelete()
+	h.deletePage(&enclaveProto.Page{}, 0)
+	if _, ok := h.redoDelete(); ok {
+		t.Fatal("redid a delete after another delete")
+	}
+}
@@ -5,13 +5,13 @@ package tui
 
 import (
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/list"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/symbolicsoft/enclave/v2/internal/notebook"
 	enclaveProto "github.com/symbolicsoft/enclave/v2/internal/proto"
 	"github.com/symbolicsoft/enclave/v2/internal/version"
 )
@@ -21,7 +21,7 @@ type ListItem struct {
 }
 
 func (li ListItem) Title() string {
-	title := strings.Split(li.page.GetBody(), "\n")[0]
+	title := notebook.PageTitle(li.page)
 	if len(title) > 32 {
 		title = title[:32] + "…"
 	}
@@ -88,8 +88,8 @@ func (lm ListModel) Construct(nb *enclaveProto.Notebook) ListModel {
 			key.WithHelp("?", "close help"),
 		),
 		Quit: key.NewBinding(
-			key.WithKeys("q"),
-			key.WithHelp("q", "quit"),
+			key.WithKeys("ctrl+c"),
+			key.WithHelp("ctrl+c", "quit"),
 		),
 		ForceQuit: key.NewBinding(key.WithKeys("ctrl+c")),
 	}
@@ -0,0 +1,244 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package tui
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/huh"
+	"github.com/symbolicsoft/enclave/v2/internal/ciphers"
+	"github.com/symbolicsoft/enclave/v2/internal/config"
+	"github.com/symbolicsoft/enclave/v2/internal/notebook"
+	enclaveProto "github.com/symbolicsoft/enclave/v2/internal/proto"
+	"golang.org/x/crypto/blake2s"
+)
+
+const LOCK_DELAY = 10 * time.Minute
+
+type lockMsg struct {
+	activity uint64
+}
+
+type unlockResultMsg struct {
+	subkeys  [3]ciphers.Subkey
+	notebook *enclaveProto.Notebook
+	revision uint64
+	pending  bool
+	offline  bool
+	err      error
+}
+
+func (mm MainModel) lockTick() tea.Cmd {
+	if mm.options.LockAfter <= 0 {
+		return nil
+	}
+	activity := mm.activity
+	return tea.Tick(mm.options.LockAfter, func(time.Time) tea.Msg {
+		return lockMsg{activity}
+	})
+}
+
+// lock encrypts any unsaved changes to the local cache, then drops the
+// decrypted notebook and wipes the subkeys until the notebook is unlocked.
+// Locking never waits on the cache: if the changes cannot be written, they
+// are kept encrypted in memory until the notebook is unlocked.
+func (mm *MainModel) lock() tea.Cmd {
+	mm.lockRequested = false
+	level, message := MessageType(MessageInfo), "Notebook locked."
+	if mm.dirty() {
+		enb, err := notebook.Encrypt(mm.subkeys(), mm.notebook, mm.revision)
+		if err != nil {
+			level, message = MessageErr, fmt.Sprintf("Notebook locked. Unsaved changes were lost: %s.", err.Error())
+		} else if err = notebook.WritePending(mm.subkeys(), enb); err != nil {
+			mm.lockedPending = enb
+			mm.pending = true
+			level, message = MessageWarn, "Notebook locked. Unsaved changes could not be written to disk and are kept in memory until you unlock."
+		} else {
+			mm.pending = true
+		}
+	}
+	mm.lockedId = blake2s.Sum256(mm.uskId)
+	mm.wipeKeys()
+	for _, page := range mm.notebook.Pages {
+		page.Body = ""
+	}
+	width, height := mm.list.list.Width(), mm.list.list.Height()
+	mm.notebook = &enclaveProto.Notebook{}
+	mm.list = ListModel{}.Construct(mm.notebook)
+	mm.list.list.SetSize(width, height)
+	mm.editor.textarea.SetValue("")
+	mm.editor.textarea.Blur()
+	mm.focusedView = 0
+	mm.pageIndex = 0
+	mm.history = newHistory()
+	mm.search, mm.find = nil, nil
+	mm.edits, mm.savedEdits = 0, 0
+	mm.conflict, mm.saveFailed, mm.saveQueued, mm.quitting = false, false, false, false
+	mm.suspended = false
+	mm.locked = true
+	mm.messages.SetMessage(level, message)
+	return mm.openDialog(mm.unlockDialog())
+}
+
+func (mm *MainModel) unlockDialog() DialogModel {
+	var secret string
+	title := "Notebook locked. Enter your passphrase to unlock it."
+	if encrypted, err := config.KeysAreEncrypted(); err == nil && encrypted {
+		title = "Notebook locked. Enter your PIN or passphrase to unlock it."
+	}
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewInput().
+				Title(title).
+				Password(true).
+				Validate(func(str string) error {
+					if len(strings.TrimSpace(str)) == 0 {
+						return errors.New("enter your PIN or passphrase")
+					}
+					return nil
+				}).
+				Value(&secret),
+		),
+	)
+	return DialogModel{}.Construct(form, mm.editor.textarea.Width(), func(mm *MainModel) tea.Cmd {
+		mm.messages.SetMessage(MessageInfo, "Unlocking...")
+		return unlock(strings.TrimSpace(secret), mm.lockedId, mm.lockedPending)
+	})
+}
+
+func unlock(secret string, lockedId [32]byte, lockedPending *enclaveProto.EncryptedNotebook) tea.Cmd {
+	return func() tea.Msg {
+		var subkeys [3]ciphers.Subkey
+		var err error
+		if strings.Contains(secret, " ") {
+			subkeys, err = passphraseSubkeys(secret, lockedId)
+		} else if config.ConfigFileExists() != nil {
+			err = errors.New("no PIN is set up on this device, enter your passphrase")
+		} else {
+			subkeys, err = config.ReadKeys(secret)
+		}
+		if err != nil {
+			return unlockResultMsg{err: err}
+		}
+		uskIdHash := blake2s.Sum256(subkeys[0])
+		if !bytes.Equal(uskIdHash[:], lockedId[:]) {
+			return unlockResultMsg{err: errors.New("this passphrase is not for the locked notebook")}
+		}
+		if lockedPending != nil {
+			// Try again to write the changes kept in memory since locking,
+			// but carry on with them regardless.
+			notebook.WritePending(subkeys, lockedPending)
+			nb, err := notebook.Decrypt(subkeys, lockedPending)
+			if err != nil {
+				return unlockResultMsg{err: err}
+			}
+			return unlockResultMsg{subkeys, nb, lockedPending.Revision, true, false, nil}
+		}
+		return loadUnlocked(subkeys)
+	}
+}
+
+// loadUnlocked loads the notebook once its keys are recovered. The keys
+// are only passed on with an error if the server sent an older revision,
+// so that it can still be accepted.
+func loadUnlocked(subkeys [3]ciphers.Subkey) unlockResultMsg {
+	nb, revision, pending, offline, err := notebook.Load(subkeys)
+	if errors.Is(err, notebook.ErrRollback) {
+		return unlockResultMsg{subkeys: subkeys, err: err}
+	}
+	if err != nil {
+		return unlockResultMsg{err: err}
+	}
+	return unlockResultMsg{subkeys, nb, revision, pending, offline, nil}
+}
+
+// passphraseSubkeys derives keys from passphrase with the KDF that the
+// locked notebook's keys came from, without needing to ask the server.
+// The KDF recorded on this device is tried first.
+func passphraseSubkeys(passphrase string, lockedId [32]byte) ([3]ciphers.Subkey, error) {
+	for _, kdf := range notebook.KdfOrder() {
+		key, err := ciphers.DeriveKeyWith(kdf, passphrase)
+		if err != nil {
+			return [3]ciphers.Subkey{}, err
+		}
+		subkeys, err := ciphers.DeriveSubkeys(key)
+		if err != nil {
+			return [3]ciphers.Subkey{}, err
+		}
+		uskIdHash := blake2s.Sum256(subkeys[0])
+		if bytes.Equal(uskIdHash[:], lockedId[:]) {
+			return subkeys, nil
+		}
+	}
+	return [3]ciphers.Subkey{}, errors.New("this passphrase is not for the locked notebook")
+}
+
+func (mm *MainModel) unlockResult(msg unlockResultMsg) tea.Cmd {
+	if errors.Is(msg.err, notebook.ErrRollback) {
+		mm.messages.SetMessage(MessageWarn, "The server sent an older version of your notebook.")
+		return mm.openDialog(mm.rollbackDialog(msg.subkeys, msg.err))
+	}
+	if msg.err != nil {
+		mm.messages.SetMessage(MessageErr, msg.err.Error())
+		return mm.openDialog(mm.unlockDialog())
+	}
+	nb := msg.notebook
+	if len(nb.Pages) == 0 {
+		nb.Pages = notebook.Create().Pages
+	}
+	mm.uskId, mm.uskEd, mm.uskWa = msg.subkeys[0], msg.subkeys[1], msg.subkeys[2]
+	mm.lockedPending = nil
+	mm.setNotebook(nb)
+	mm.revision = msg.revision
+	mm.pending = msg.pending
+	mm.offline = msg.offline
+	mm.locked = false
+	mm.activity++
+	if mm.pending {
+		mm.messages.SetMessage(MessageOK, "Notebook unlocked. Unsaved changes will be synced shortly.")
+	} else {
+		mm.messages.SetMessage(MessageOK, "Notebook unlocked.")
+	}
+	return nil
+}
+
+// rollbackDialog asks whether to accept an older notebook from the server
+// when unlocking, as setup does when opening it. Refusing locks the
+// notebook again.
+func (mm *MainModel) rollbackDialog(subkeys [3]ciphers.Subkey, err error) DialogModel {
+	var accept bool
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewConfirm().
+				Title("The server sent an older version of your notebook!").
+				Description(strings.Join([]string{
+					err.Error() + ".",
+					"The server may be replaying an old copy of your notebook, hiding recent changes.",
+					"Only accept it if you know why, for instance if the server was restored from a backup.",
+				}, "\n")).
+				Affirmative("Accept older version").
+				Negative("Refuse").
+				Value(&accept),
+		),
+	)
+	return DialogModel{}.Construct(form, mm.editor.textarea.Width(), func(mm *MainModel) tea.Cmd {
+		if !accept {
+			for _, sk := range subkeys {
+				ciphers.Wipe(sk)
+			}
+			mm.messages.SetMessage(MessageErr, "Refused the older version of your notebook.")
+			return mm.openDialog(mm.unlockDialog())
+		}
+		mm.messages.SetMessage(MessageInfo, "Unlocking...")
+		return func() tea.Msg {
+			notebook.ForgetRevision(subkeys)
+			return loadUnlocked(subkeys)
+		}
+	})
+}
@@ -5,18 +5,27 @@ package tui
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/huh"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/symbolicsoft/enclave/v2/internal/ciphers"
 	"github.com/symbolicsoft/enclave/v2/internal/client"
 	"github.com/symbolicsoft/enclave/v2/internal/config"
+	"github.com/symbolicsoft/enclave/v2/internal/export"
+	"github.com/symbolicsoft/enclave/v2/internal/importer"
 	"github.com/symbolicsoft/enclave/v2/internal/notebook"
 	enclaveProto "github.com/symbolicsoft/enclave/v2/internal/proto"
 	"github.com/symbolicsoft/enclave/v2/internal/setup"
+	"google.golang.org/protobuf/proto"
 )
 
 var (
@@ -39,42 +48,206 @@ var (
 )
 
 type MainModel struct {
-	list        ListModel
-	editor      EditorModel
-	messages    MessagesModel
-	focusedView uint
-	uskId       ciphers.Subkey
-	uskEd       ciphers.Subkey
-	notebook    *enclaveProto.Notebook
-	pageIndex   int
+	list          ListModel
+	editor        EditorModel
+	messages      MessagesModel
+	focusedView   uint
+	uskId         ciphers.Subkey
+	uskEd         ciphers.Subkey
+	uskWa         ciphers.Subkey
+	notebook      *enclaveProto.Notebook
+	pageIndex     int
+	revision      uint64
+	conflict      bool
+	pending       bool
+	offline       bool
+	saving        bool
+	saveQueued    bool
+	saveFailed    bool
+	suspended     bool
+	operating     bool
+	quitting      bool
+	options       Options
+	activity      uint64
+	locked        bool
+	lockRequested bool
+	lockedId      [32]byte
+	lockedPending *enclaveProto.EncryptedNotebook
+	panicked      bool
+	edits         uint64
+	savedEdits    uint64
+	dialog        *DialogModel
+	search        *SearchModel
+	find          *FindModel
+	history       *history
 }
 
-func (mm MainModel) Construct(subkeys [2]ciphers.Subkey, nb *enclaveProto.Notebook) MainModel {
+type Options struct {
+	Autosave    time.Duration
+	LockAfter   time.Duration
+	PanicKey    string
+	PanicDelete bool
+}
+
+const SYNC_INTERVAL = 15 * time.Second
+const AUTOSAVE_DELAY = 5 * time.Second
+
+type syncTickMsg struct{}
+
+type autosaveMsg struct {
+	edits uint64
+}
+
+type flushMsg struct{}
+
+type connectivityMsg struct {
+	err error
+}
+
+type saveResultMsg struct {
+	revision uint64
+	edits    uint64
+	err      error
+}
+
+type deleteResultMsg struct {
+	err error
+}
+
+type decoyResultMsg struct {
+	detach     bool
+	passphrase string
+	revision   uint64
+	err        error
+}
+
+type reloadResultMsg struct {
+	nb       *enclaveProto.Notebook
+	revision uint64
+	err      error
+}
+
+type overwriteResultMsg struct {
+	revision uint64
+	err      error
+}
+
+type rekeyResultMsg struct {
+	passphrase string
+	subkeys    [3]ciphers.Subkey
+	revision   uint64
+	edits      uint64
+	keysErr    error
+	err        error
+}
+
+func (mm MainModel) Construct(subkeys [3]ciphers.Subkey, nb *enclaveProto.Notebook, revision uint64, pending bool, offline bool, options Options) MainModel {
 	if len(nb.Pages) == 0 {
-		nb = notebook.Create()
+		nb.Pages = notebook.Create().Pages
 	}
 	mm = MainModel{
-		list:        ListModel{}.Construct(nb),
-		editor:      EditorModel{}.Construct(),
-		messages:    MessagesModel{}.Construct(),
-		focusedView: 0,
-		uskId:       subkeys[0],
-		uskEd:       subkeys[1],
-		notebook:    nb,
-		pageIndex:   0,
+		list:          ListModel{}.Construct(nb),
+		editor:        EditorModel{}.Construct(),
+		messages:      MessagesModel{}.Construct(),
+		focusedView:   0,
+		uskId:         subkeys[0],
+		uskEd:         subkeys[1],
+		uskWa:         subkeys[2],
+		notebook:      nb,
+		pageIndex:     0,
+		revision:      revision,
+		conflict:      false,
+		pending:       pending,
+		offline:       offline,
+		saving:        false,
+		saveQueued:    false,
+		saveFailed:    false,
+		suspended:     false,
+		operating:     false,
+		quitting:      false,
+		options:       options,
+		activity:      0,
+		locked:        false,
+		lockRequested: false,
+		lockedId:      [32]byte{},
+		lockedPending: nil,
+		panicked:      false,
+		edits:         0,
+		savedEdits:    0,
+		dialog:        nil,
+		search:        nil,
+		find:          nil,
+		history:       newHistory(),
 	}
 	mm.editor.textarea.SetValue(mm.notebook.Pages[0].Body)
+	if pending {
+		mm.messages.SetMessage(MessageWarn, "Opened unsynced local changes. They will be pushed when the server is reachable.")
+	} else if offline {
+		mm.messages.SetMessage(MessageWarn, "Working offline from the local copy of your notebook.")
+	} else if notebook.NeedsMigration(nb) {
+		mm.messages.SetMessage(MessageWarn, "This notebook uses older key derivation parameters. Run \"enclave migrate\" to upgrade.")
+	}
 	return mm
 }
 
 func (mm MainModel) Init() tea.Cmd {
-	return nil
+	return tea.Batch(syncTick(), mm.lockTick())
 }
 
 func (mm MainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	edits, activity := mm.edits, mm.activity
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		if len(mm.options.PanicKey) > 0 && msg.String() == mm.options.PanicKey {
+			cmd := mm.panicQuit()
+			return mm, cmd
+		}
+		mm.activity++
+	}
+	mmNew, cmd := mm.update(msg)
+	mm = mmNew.(MainModel)
+	if mm.activity != activity && !mm.locked {
+		cmd = tea.Batch(cmd, mm.lockTick())
+	}
+	if mm.edits != edits {
+		cmd = tea.Batch(cmd, mm.autosaveTick())
+	}
+	return mm, cmd
+}
+
+func (mm MainModel) autosaveTick() tea.Cmd {
+	if mm.options.Autosave <= 0 {
+		return nil
+	}
+	edits := mm.edits
+	return tea.Tick(mm.options.Autosave, func(time.Time) tea.Msg {
+		return autosaveMsg{edits}
+	})
+}
+
+func (mm MainModel) update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmds []tea.Cmd
 	updateNotebook := false
 	previousValue := ""
+	switch msg.(type) {
+	case tea.WindowSizeMsg, syncTickMsg, connectivityMsg, saveResultMsg, autosaveMsg, flushMsg, lockMsg, unlockResultMsg,
+		deleteResultMsg, decoyResultMsg, rekeyResultMsg, reloadResultMsg, overwriteResultMsg:
+	default:
+		if mm.dialog != nil {
+			return mm.updateDialog(msg)
+		}
+	}
+	if msg, ok := msg.(tea.KeyMsg); mm.locked && ok {
+		if msg.String() == "ctrl+c" {
+			return mm, tea.Quit
+		}
+		return mm, nil
+	}
+	if msg, ok := msg.(tea.KeyMsg); mm.search != nil && ok {
+		return mm.updateSearch(msg)
+	}
+	if msg, ok := msg.(tea.KeyMsg); mm.find != nil && ok {
+		return mm.updateFind(msg)
+	}
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		switch mm.focusedView {
@@ -99,19 +272,70 @@ func (mm MainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				mm.editor.textarea.SetValue(mm.notebook.Pages[mm.pageIndex].Body)
 				mm.focusedView = 1
 				mm.editor.textarea.Focus()
+				mm.edits++
 				mm.messages.SetMessage(MessageInfo, "Page created.")
 			case "ctrl+d":
 				if len(mm.list.list.Items()) > 0 {
 					listPageIndex := mm.list.list.Index()
-					mm.list.list.RemoveItem(listPageIndex)
-					mm.notebook.Pages = append(mm.notebook.Pages[:listPageIndex], mm.notebook.Pages[listPageIndex+1:]...)
-					mm.messages.SetMessage(MessageInfo, "Page deleted.")
+					mm.history.deletePage(mm.notebook.Pages[listPageIndex], listPageIndex)
+					mm.removePage(listPageIndex)
+					mm.edits++
+					mm.messages.SetMessage(MessageInfo, "Page deleted. Press ctrl+z to restore it.")
+				}
+			case "ctrl+z":
+				if dp, ok := mm.history.undoDelete(); ok {
+					mm.insertPage(dp.page, min(dp.index, len(mm.notebook.Pages)))
+					mm.edits++
+					mm.messages.SetMessage(MessageInfo, "Page restored. Notebook updated since last save.")
+				} else {
+					mm.messages.SetMessage(MessageWarn, "Nothing to undo.")
+				}
+			case "ctrl+y":
+				if dp, ok := mm.history.redoDelete(); ok {
+					for i, page := range mm.notebook.Pages {
+						if page == dp.page {
+							mm.removePage(i)
+						}
+					}
+					mm.edits++
+					mm.messages.SetMessage(MessageInfo, "Page deleted again. Notebook updated since last save.")
+				} else {
+					mm.messages.SetMessage(MessageWarn, "Nothing to redo.")
 				}
 			case "ctrl+s":
-				mm.messages.SetMessage(MessageInfo, "Saving notebook...")
-				mm.saveNotebook()
+				return mm, mm.saveNotebook()
+			case "ctrl+r":
+				if mm.conflict && !mm.waitForSave() {
+					return mm, mm.reloadNotebook()
+				}
+			case "ctrl+o":
+				if mm.conflict && !mm.waitForSave() {
+					return mm, mm.overwriteNotebook()
+				}
+			case "ctrl+f":
+				return mm, mm.openSearch()
+			case "ctrl+x":
+				if !mm.waitForSave() {
+					return mm, mm.openOperation(mm.deleteNotebookDialog())
+				}
+			case "ctrl+e":
+				if !mm.waitForSave() {
+					return mm, mm.openOperation(mm.decoyDialog())
+				}
+			case "ctrl+k":
+				if !mm.waitForSave() {
+					return mm, mm.openOperation(mm.rekeyDialog())
+				}
+			case "ctrl+p":
+				if !mm.waitForOperation() {
+					return mm, mm.openDialog(mm.exportDialog())
+				}
+			case "ctrl+u":
+				if !mm.waitForOperation() {
+					return mm, mm.openDialog(mm.importDialog())
+				}
 			case "ctrl+c":
-				return mm, tea.Quit
+				return mm, mm.quit()
 			}
 		default:
 			switch msg.String() {
@@ -119,10 +343,25 @@ func (mm MainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				mm.focusedView = 0
 				mm.editor.textarea.Blur()
 			case "ctrl+s":
-				mm.messages.SetMessage(MessageInfo, "Saving notebook...")
-				mm.saveNotebook()
+				return mm, mm.saveNotebook()
+			case "ctrl+r":
+				if mm.conflict && !mm.waitForSave() {
+					return mm, mm.reloadNotebook()
+				}
+			case "ctrl+o":
+				if mm.conflict && !mm.waitForSave() {
+					return mm, mm.overwriteNotebook()
+				}
+			case "ctrl+f":
+				return mm, mm.openSearch()
+			case "ctrl+w":
+				return mm, mm.openFind()
+			case "ctrl+z":
+				mm.undoEdit(mm.history.undo, "undo")
+			case "ctrl+y":
+				mm.undoEdit(mm.history.redo, "redo")
 			case "ctrl+c":
-				return mm, tea.Quit
+				return mm, mm.quit()
 			default:
 				updateNotebook = true
 				previousValue = mm.editor.textarea.Value()
@@ -139,10 +378,61 @@ func (mm MainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			cmds = append(cmds, cmd)
 		}
 		if updateNotebook && previousValue != mm.editor.textarea.Value() {
+			mm.history.record(mm.notebook.Pages[mm.pageIndex], previousValue, editKind(msg))
 			mm.notebook.Pages[mm.pageIndex].Body = mm.editor.textarea.Value()
 			mm.notebook.Pages[mm.pageIndex].ModDate = time.Now().Unix()
+			mm.edits++
 			mm.messages.SetMessage(MessageInfo, "Notebook updated since last save.")
 		}
+	case syncTickMsg:
+		if (mm.pending || mm.offline) && !mm.locked && !mm.suspended {
+			cmds = append(cmds, checkConnectivity)
+		}
+		cmds = append(cmds, syncTick())
+	case connectivityMsg:
+		if msg.err == nil && (mm.pending || mm.offline) && !mm.locked && !mm.suspended {
+			mm.offline = false
+			if mm.pending {
+				mm.messages.SetMessage(MessageInfo, "Back online. Syncing notebook...")
+				cmds = append(cmds, mm.saveNotebook())
+			} else {
+				mm.messages.SetMessage(MessageOK, "Back online.")
+			}
+		}
+	case saveResultMsg:
+		cmds = append(cmds, mm.saveResult(msg))
+		if mm.lockRequested && !mm.saving && !mm.operating {
+			cmds = append(cmds, mm.lock())
+		}
+	case lockMsg:
+		if msg.activity == mm.activity && !mm.locked {
+			if mm.saving || mm.operating {
+				mm.lockRequested = true
+			} else {
+				cmds = append(cmds, mm.lock())
+			}
+		}
+	case unlockResultMsg:
+		cmds = append(cmds, mm.unlockResult(msg))
+	case autosaveMsg:
+		if msg.edits == mm.edits && mm.dirty() && !mm.conflict && !mm.suspended {
+			cmds = append(cmds, mm.saveNotebook())
+		}
+	case deleteResultMsg:
+		cmds = append(cmds, mm.deleteResult(msg))
+	case decoyResultMsg:
+		cmds = append(cmds, mm.decoyResult(msg))
+	case rekeyResultMsg:
+		cmds = append(cmds, mm.rekeyResult(msg))
+	case reloadResultMsg:
+		cmds = append(cmds, mm.reloadResult(msg))
+	case overwriteResultMsg:
+		cmds = append(cmds, mm.overwriteResult(msg))
+	case flushMsg:
+		if mm.dirty() {
+			notebook.SavePending(mm.subkeys(), mm.notebook, mm.revision)
+		}
+		return mm, tea.Quit
 	case tea.WindowSizeMsg:
 		lR, lC := (30 * (msg.Width) / 100), (msg.Height - 3)
 		eR, eC := (70 * (msg.Width) / 100), (msg.Height - 3)
@@ -153,13 +443,80 @@ func (mm MainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		mm.editor.textarea.SetHeight(eC)
 		mm.messages.Width = (msg.Width - 3)
 		mm.messages.Height = 1
+		if mm.search != nil {
+			mm.search.width, mm.search.height = eR, eC
+		}
+		if mm.find != nil {
+			mm.find.width, mm.find.height = mm.editor.textarea.Width(), eC
+		}
+	default:
+		if mm.search != nil {
+			smNew, cmd := mm.search.Update(msg)
+			search := smNew.(SearchModel)
+			mm.search = &search
+			cmds = append(cmds, cmd)
+		}
+		if mm.find != nil {
+			fmNew, cmd := mm.find.Update(msg)
+			find := fmNew.(FindModel)
+			mm.find = &find
+			cmds = append(cmds, cmd)
+		}
 	}
 	return mm, tea.Batch(cmds...)
 }
 
 func (mm MainModel) View() string {
 	var s string
-	if mm.focusedView == 0 {
+	if mm.panicked {
+		return s
+	}
+	mm.messages.SetStatus(mm.syncStatus())
+	if mm.dialog != nil {
+		s += lipgloss.JoinVertical(lipgloss.Left,
+			lipgloss.JoinHorizontal(lipgloss.Center,
+				listStyle.Render(mm.list.View()),
+				editorStyleFocused.Render(lipgloss.Place(
+					mm.editor.textarea.Width(), mm.editor.textarea.Height(),
+					lipgloss.Center, lipgloss.Center,
+					mm.dialog.View(),
+				)),
+			),
+			messagesStyle.Render(mm.messages.View()),
+		)
+	} else if mm.locked {
+		s += lipgloss.JoinVertical(lipgloss.Left,
+			lipgloss.JoinHorizontal(lipgloss.Center,
+				listStyle.Render(mm.list.View()),
+				editorStyleFocused.Render(lipgloss.Place(
+					mm.editor.textarea.Width(), mm.editor.textarea.Height(),
+					lipgloss.Center, lipgloss.Center,
+					"Unlocking...",
+				)),
+			),
+			messagesStyle.Render(mm.messages.View()),
+		)
+	} else if mm.search != nil {
+		s += lipgloss.JoinVertical(lipgloss.Left,
+			lipgloss.JoinHorizontal(lipgloss.Center,
+				listStyle.Render(mm.list.View()),
+				editorStyleFocused.Render(lipgloss.Place(
+					mm.editor.textarea.Width(), mm.editor.textarea.Height(),
+					lipgloss.Left, lipgloss.Top,
+					mm.search.View(),
+				)),
+			),
+			messagesStyle.Render(mm.messages.View()),
+		)
+	} else if mm.find != nil {
+		s += lipgloss.JoinVertical(lipgloss.Left,
+			lipgloss.JoinHorizontal(lipgloss.Center,
+				listStyle.Render(mm.list.View()),
+				editorStyleFocused.Render(mm.find.View()),
+			),
+			messagesStyle.Render(mm.messages.View()),
+		)
+	} else if mm.focusedView == 0 {
 		s += lipgloss.JoinVertical(lipgloss.Left,
 			lipgloss.JoinHorizontal(lipgloss.Center,
 				listStyleFocused.Render(mm.list.View()),
@@ -179,50 +536,777 @@ func (mm MainModel) View() string {
 	return s
 }
 
-func (mm *MainModel) saveNotebook() {
-	ct, err := notebook.Encrypt(mm.uskEd, mm.notebook)
-	if err != nil {
-		mm.messages.SetMessage(MessageErr, err.Error())
+func (mm *MainModel) saveNotebook() tea.Cmd {
+	if mm.saving || mm.suspended {
+		mm.saveQueued = true
+		return nil
+	}
+	mm.saving = true
+	mm.saveQueued = false
+	mm.messages.SetMessage(MessageInfo, "Saving notebook...")
+	subkeys, revision, edits := mm.subkeys(), mm.revision, mm.edits
+	nb := proto.Clone(mm.notebook).(*enclaveProto.Notebook)
+	return func() tea.Msg {
+		revision, err := notebook.Save(subkeys, nb, revision)
+		return saveResultMsg{revision, edits, err}
+	}
+}
+
+func (mm *MainModel) saveResult(msg saveResultMsg) tea.Cmd {
+	mm.saving = false
+	mm.saveFailed = false
+	if errors.Is(msg.err, client.ErrOffline) {
+		mm.pending = true
+		mm.offline = true
+		mm.savedEdits = msg.edits
+		mm.messages.SetMessage(MessageWarn, "Server unreachable. Saved locally, will sync when back online.")
+	} else if errors.Is(msg.err, client.ErrConflict) {
+		mm.pending = false
+		mm.saveQueued = false
+		mm.quitting = false
+		mm.setConflict()
+		return nil
+	} else if msg.err != nil {
+		mm.saveFailed = true
+		mm.saveQueued = false
+		mm.quitting = false
+		mm.messages.SetMessage(MessageErr, fmt.Sprintf("%s. Press ctrl+s to retry.", msg.err.Error()))
+		return nil
 	} else {
-		err = client.PutNotebook(mm.uskId, []byte{}, ct)
+		mm.revision = msg.revision
+		mm.conflict = false
+		mm.pending = false
+		mm.offline = false
+		mm.savedEdits = msg.edits
+		mm.messages.SetMessage(MessageOK, "Notebook saved.")
+	}
+	if mm.saveQueued || (mm.quitting && mm.edits != mm.savedEdits) {
+		return mm.saveNotebook()
+	}
+	if mm.quitting {
+		return tea.Quit
+	}
+	return nil
+}
+
+func (mm MainModel) dirty() bool {
+	return mm.edits != mm.savedEdits || mm.saving
+}
+
+func (mm *MainModel) quit() tea.Cmd {
+	if mm.waitForOperation() {
+		return nil
+	}
+	if !mm.dirty() {
+		return tea.Quit
+	}
+	return mm.openDialog(mm.quitDialog())
+}
+
+func (mm MainModel) syncStatus() SyncStatus {
+	switch {
+	case mm.saving:
+		return SyncSaving
+	case mm.conflict:
+		return SyncConflict
+	case mm.saveFailed:
+		return SyncFailed
+	case mm.edits != mm.savedEdits:
+		return SyncDirty
+	case mm.pending && mm.offline:
+		return SyncOffline
+	case mm.pending:
+		return SyncDirty
+	}
+	return SyncSynced
+}
+
+func (mm *MainModel) setConflict() {
+	mm.conflict = true
+	mm.messages.SetMessage(MessageWarn, "Notebook was modified elsewhere. ctrl+r: reload (discard local edits), ctrl+o: overwrite.")
+}
+
+func (mm *MainModel) reloadNotebook() tea.Cmd {
+	mm.suspended = true
+	subkeys := mm.subkeys()
+	return mm.runOperation(func() tea.Msg {
+		nb, revision, err := notebook.Restore(subkeys)
+		return reloadResultMsg{nb, revision, err}
+	})
+}
+
+func (mm *MainModel) reloadResult(msg reloadResultMsg) tea.Cmd {
+	mm.saveQueued = false
+	if msg.err != nil {
+		cmd := mm.resume()
+		mm.messages.SetMessage(MessageErr, msg.err.Error())
+		return cmd
+	}
+	if len(msg.nb.Pages) == 0 {
+		msg.nb.Pages = notebook.Create().Pages
+	}
+	mm.setNotebook(msg.nb)
+	mm.revision = msg.revision
+	mm.conflict = false
+	mm.pending = false
+	mm.offline = false
+	mm.saveFailed = false
+	mm.savedEdits = mm.edits
+	cmd := mm.resume()
+	mm.messages.SetMessage(MessageOK, "Notebook reloaded.")
+	return cmd
+}
+
+func (mm *MainModel) setNotebook(nb *enclaveProto.Notebook) {
+	width, height := mm.list.list.Width(), mm.list.list.Height()
+	mm.list = ListModel{}.Construct(nb)
+	mm.list.list.SetSize(width, height)
+	if nb != mm.notebook {
+		mm.history = newHistory()
+	}
+	mm.notebook = nb
+	mm.pageIndex = 0
+	mm.editor.textarea.SetValue(mm.notebook.Pages[0].Body)
+}
+
+func (mm *MainModel) overwriteNotebook() tea.Cmd {
+	mm.suspended = true
+	uskId := mm.uskId
+	return mm.runOperation(func() tea.Msg {
+		enb, err := client.GetNotebook(uskId)
 		if err != nil {
-			mm.messages.SetMessage(MessageErr, err.Error())
+			return overwriteResultMsg{0, err}
+		}
+		return overwriteResultMsg{enb.Revision, nil}
+	})
+}
+
+func (mm *MainModel) overwriteResult(msg overwriteResultMsg) tea.Cmd {
+	if msg.err != nil {
+		mm.saveQueued = false
+		cmd := mm.resume()
+		mm.messages.SetMessage(MessageErr, msg.err.Error())
+		return cmd
+	}
+	mm.revision = msg.revision
+	mm.saveQueued = true
+	return mm.resume()
+}
+
+func (mm *MainModel) waitForSave() bool {
+	if mm.waitForOperation() {
+		return true
+	}
+	if mm.saving {
+		mm.messages.SetMessage(MessageWarn, "Wait for the notebook to finish saving.")
+	}
+	return mm.saving
+}
+
+func (mm *MainModel) waitForOperation() bool {
+	if mm.operating {
+		mm.messages.SetMessage(MessageWarn, "Wait for the current operation to finish.")
+	}
+	return mm.operating
+}
+
+// openOperation opens the dialog of an operation that deletes or moves the
+// notebook on the server. Saves are held back from the moment it opens
+// until the operation is cancelled or has completed, so that none can land
+// on the old notebook once it is gone.
+func (mm *MainModel) openOperation(dialog DialogModel) tea.Cmd {
+	mm.suspended = true
+	return mm.openDialog(dialog)
+}
+
+// runOperation runs the network part of an operation in the background.
+func (mm *MainModel) runOperation(cmd tea.Cmd) tea.Cmd {
+	mm.operating = true
+	mm.messages.SetMessage(MessageInfo, "Working...")
+	return cmd
+}
+
+// resume lets saves go ahead again after an operation, catching up on
+// any that were held back.
+func (mm *MainModel) resume() tea.Cmd {
+	mm.suspended, mm.operating = false, false
+	var cmds []tea.Cmd
+	if mm.saveQueued {
+		cmds = append(cmds, mm.saveNotebook())
+	} else if mm.edits != mm.savedEdits {
+		cmds = append(cmds, mm.autosaveTick())
+	}
+	if mm.lockRequested && !mm.saving {
+		if mm.dialog != nil {
+			// Leave a newly generated passphrase on screen for another
+			// lock delay rather than locking it away unseen.
+			mm.lockRequested = false
+			cmds = append(cmds, mm.lockTick())
 		} else {
-			mm.messages.SetMessage(MessageOK, "Notebook saved.")
+			cmds = append(cmds, mm.lock())
+		}
+	}
+	return tea.Batch(cmds...)
+}
+
+func syncTick() tea.Cmd {
+	return tea.Tick(SYNC_INTERVAL, func(time.Time) tea.Msg {
+		return syncTickMsg{}
+	})
+}
+
+func checkConnectivity() tea.Msg {
+	return connectivityMsg{client.PingPong()}
+}
+
+func (mm *MainModel) subkeys() [3]ciphers.Subkey {
+	return [3]ciphers.Subkey{mm.uskId, mm.uskEd, mm.uskWa}
+}
+
+func (mm *MainModel) openDialog(dialog DialogModel) tea.Cmd {
+	mm.dialog = &dialog
+	return mm.dialog.Init()
+}
+
+func (mm MainModel) updateDialog(msg tea.Msg) (tea.Model, tea.Cmd) {
+	dmNew, cmd := mm.dialog.Update(msg)
+	dialog := dmNew.(DialogModel)
+	mm.dialog = &dialog
+	if dialog.Completed() {
+		mm.dialog = nil
+		return mm, tea.Batch(cmd, dialog.action(&mm))
+	}
+	if dialog.Aborted() {
+		mm.dialog = nil
+		if mm.locked {
+			return mm, tea.Quit
+		}
+		mm.messages.SetMessage(MessageInfo, "Cancelled.")
+		if mm.suspended && !mm.operating {
+			cmd = tea.Batch(cmd, mm.resume())
+		}
+	}
+	return mm, cmd
+}
+
+func (mm *MainModel) openSearch() tea.Cmd {
+	search := SearchModel{}.Construct(mm.notebook, mm.editor.textarea.Width(), mm.editor.textarea.Height())
+	mm.search = &search
+	return mm.search.Init()
+}
+
+func (mm MainModel) updateSearch(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc", "ctrl+f":
+		mm.search = nil
+		return mm, nil
+	case "enter":
+		hit, ok := mm.search.Selected()
+		if !ok {
+			return mm, nil
+		}
+		mm.search = nil
+		return mm, mm.jumpTo(hit.pageIndex, hit.line, hit.col)
+	case "ctrl+c":
+		return mm, mm.quit()
+	}
+	smNew, cmd := mm.search.Update(msg)
+	search := smNew.(SearchModel)
+	mm.search = &search
+	return mm, cmd
+}
+
+func (mm *MainModel) openFind() tea.Cmd {
+	lines := strings.Split(mm.editor.textarea.Value(), "\n")
+	lineInfo := mm.editor.textarea.LineInfo()
+	origin := len(strings.Join(lines[:mm.editor.textarea.Line()], "\n"))
+	if mm.editor.textarea.Line() > 0 {
+		origin++
+	}
+	line := []rune(lines[mm.editor.textarea.Line()])
+	origin += len(string(line[:min(lineInfo.StartColumn+lineInfo.ColumnOffset, len(line))]))
+	find := FindModel{}.Construct(
+		mm.notebook.Pages[mm.pageIndex].Body, origin,
+		mm.editor.textarea.Width(), mm.editor.textarea.Height(),
+	)
+	mm.find = &find
+	return mm.find.Init()
+}
+
+func (mm MainModel) updateFind(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc", "ctrl+w":
+		if !mm.find.confirming {
+			line, col, ok := mm.find.Position()
+			mm.find = nil
+			if ok {
+				return mm, mm.jumpTo(mm.pageIndex, line, col)
+			}
+			return mm, nil
+		}
+	case "ctrl+c":
+		return mm, mm.quit()
+	}
+	page := mm.notebook.Pages[mm.pageIndex]
+	changed := mm.find.changed
+	fmNew, cmd := mm.find.Update(msg)
+	find := fmNew.(FindModel)
+	mm.find = &find
+	if mm.find.body != page.Body {
+		if !changed {
+			mm.history.record(page, page.Body, "")
+		}
+		page.Body = mm.find.body
+		page.ModDate = time.Now().Unix()
+		mm.edits++
+		mm.editor.textarea.SetValue(page.Body)
+		mm.messages.SetMessage(MessageInfo, "Notebook updated since last save. Press ctrl+z to undo the replacements.")
+	}
+	return mm, cmd
+}
+
+func (mm *MainModel) undoEdit(step func(*enclaveProto.Page) (string, bool), name string) {
+	page := mm.notebook.Pages[mm.pageIndex]
+	body, ok := step(page)
+	if !ok {
+		mm.messages.SetMessage(MessageWarn, fmt.Sprintf("Nothing to %s.", name))
+		return
+	}
+	line := mm.editor.textarea.Line()
+	page.Body = body
+	page.ModDate = time.Now().Unix()
+	mm.edits++
+	mm.editor.textarea.SetValue(body)
+	for mm.editor.textarea.Line() > line {
+		mm.editor.textarea.CursorUp()
+	}
+	mm.messages.SetMessage(MessageInfo, "Notebook updated since last save.")
+}
+
+func (mm *MainModel) removePage(index int) {
+	mm.list.list.RemoveItem(index)
+	mm.notebook.Pages = append(mm.notebook.Pages[:index], mm.notebook.Pages[index+1:]...)
+	switch {
+	case mm.pageIndex > index:
+		mm.pageIndex--
+	case mm.pageIndex == index && len(mm.notebook.Pages) > 0:
+		mm.pageIndex = min(index, len(mm.notebook.Pages)-1)
+		mm.editor.textarea.SetValue(mm.notebook.Pages[mm.pageIndex].Body)
+	}
+}
+
+func (mm *MainModel) insertPage(page *enclaveProto.Page, index int) {
+	mm.notebook.Pages = append(mm.notebook.Pages[:index], append([]*enclaveProto.Page{page}, mm.notebook.Pages[index:]...)...)
+	mm.list.list.InsertItem(index, ListItem{page})
+	mm.list.list.Select(index)
+	if len(mm.notebook.Pages) == 1 {
+		mm.pageIndex = 0
+		mm.editor.textarea.SetValue(page.Body)
+	} else if mm.pageIndex >= index {
+		mm.pageIndex++
+	}
+}
+
+func editKind(msg tea.KeyMsg) string {
+	switch msg.Type {
+	case tea.KeyRunes, tea.KeySpace:
+		return "insert"
+	case tea.KeyBackspace:
+		return "delete"
+	}
+	return ""
+}
+
+func (mm *MainModel) jumpTo(pageIndex int, line int, col int) tea.Cmd {
+	mm.pageIndex = pageIndex
+	mm.list.list.Select(pageIndex)
+	mm.editor.textarea.SetValue(mm.notebook.Pages[pageIndex].Body)
+	mm.focusedView = 1
+	cmd := mm.editor.textarea.Focus()
+	for mm.editor.textarea.Line() > line {
+		mm.editor.textarea.CursorUp()
+	}
+	mm.editor.textarea.SetCursor(col)
+	// Let the textarea scroll its viewport to the new cursor position.
+	mm.editor.textarea, _ = mm.editor.textarea.Update(nil)
+	return cmd
+}
+
+func (mm *MainModel) deleteNotebookDialog() DialogModel {
+	var confirmation string
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewInput().
+				Title("Permanently delete this notebook?").
+				Description(strings.Join([]string{
+					"The notebook will be deleted from the Enclave server and your",
+					"stored access keys will be removed from this computer.",
+					"Any decoy notebook pointing at it will be unlinked.",
+					"This cannot be undone.",
+					"",
+					fmt.Sprintf("Type %q to confirm, or press ctrl+c to cancel.", setup.DELETE_CONFIRMATION),
+				}, "\n")).
+				Validate(func(str string) error {
+					if str != setup.DELETE_CONFIRMATION {
+						return fmt.Errorf("type %q to confirm", setup.DELETE_CONFIRMATION)
+					}
+					return nil
+				}).
+				Value(&confirmation),
+		),
+	)
+	return DialogModel{}.Construct(form, mm.editor.textarea.Width(), func(mm *MainModel) tea.Cmd {
+		subkeys, revision := mm.subkeys(), mm.revision
+		nb := proto.Clone(mm.notebook).(*enclaveProto.Notebook)
+		return mm.runOperation(func() tea.Msg {
+			return deleteResultMsg{notebook.Delete(subkeys, nb, revision)}
+		})
+	})
+}
+
+func (mm *MainModel) deleteResult(msg deleteResultMsg) tea.Cmd {
+	if msg.err != nil {
+		cmd := mm.resume()
+		mm.messages.SetMessage(MessageErr, msg.err.Error())
+		return cmd
+	}
+	config.Delete()
+	return tea.Quit
+}
+
+const (
+	decoyAttach = iota
+	decoyRotate
+	decoyDetach
+)
+
+const (
+	quitSave = iota
+	quitDiscard
+	quitCancel
+)
+
+func (mm *MainModel) quitDialog() DialogModel {
+	var choice int
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewSelect[int]().
+				Title("Your notebook has unsaved changes").
+				Options(
+					huh.NewOption("Save and quit", quitSave),
+					huh.NewOption("Quit without saving", quitDiscard),
+					huh.NewOption("Cancel", quitCancel),
+				).
+				Value(&choice),
+		),
+	)
+	return DialogModel{}.Construct(form, mm.editor.textarea.Width(), func(mm *MainModel) tea.Cmd {
+		switch choice {
+		case quitSave:
+			mm.quitting = true
+			if mm.saving {
+				return nil
+			}
+			return mm.saveNotebook()
+		case quitDiscard:
+			return tea.Quit
 		}
+		mm.messages.SetMessage(MessageInfo, "Cancelled.")
+		return nil
+	})
+}
+
+func (mm *MainModel) decoyDialog() DialogModel {
+	var choice int
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewSelect[int]().
+				Title("Manage decoy notebook").
+				Description(strings.Join([]string{
+					"Loading a decoy notebook more than once permanently deletes",
+					"this notebook. Press ctrl+c to cancel.",
+				}, "\n")).
+				Options(
+					huh.NewOption("Attach a new decoy notebook", decoyAttach),
+					huh.NewOption("Rotate: replace and delete the current decoy", decoyRotate),
+					huh.NewOption("Detach the current decoy", decoyDetach),
+				).
+				Value(&choice),
+		),
+	)
+	return DialogModel{}.Construct(form, mm.editor.textarea.Width(), func(mm *MainModel) tea.Cmd {
+		subkeys, revision := mm.subkeys(), mm.revision
+		nb := proto.Clone(mm.notebook).(*enclaveProto.Notebook)
+		return mm.runOperation(func() tea.Msg {
+			if choice == decoyDetach {
+				revision, err := notebook.DetachDecoy(subkeys, nb, revision)
+				return decoyResultMsg{detach: true, revision: revision, err: err}
+			}
+			passphrase, revision, err := notebook.CreateDecoy(subkeys, nb, revision, choice == decoyRotate)
+			return decoyResultMsg{passphrase: passphrase, revision: revision, err: err}
+		})
+	})
+}
+
+func (mm *MainModel) decoyResult(msg decoyResultMsg) tea.Cmd {
+	if errors.Is(msg.err, client.ErrConflict) {
+		mm.saveQueued = false
+		cmd := mm.resume()
+		mm.setConflict()
+		return cmd
+	} else if msg.err != nil {
+		cmd := mm.resume()
+		mm.messages.SetMessage(MessageErr, msg.err.Error())
+		return cmd
+	}
+	mm.revision = msg.revision
+	if msg.detach {
+		mm.messages.SetMessage(MessageOK, "Decoy notebook detached.")
+		return mm.resume()
+	}
+	mm.messages.SetMessage(MessageOK, "Decoy notebook attached.")
+	cmd := mm.openDialog(mm.passphraseDialog("Decoy passphrase generated:", msg.passphrase))
+	return tea.Batch(cmd, mm.resume())
+}
+
+func (mm *MainModel) passphraseDialog(title string, passphrase string) DialogModel {
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewConfirm().
+				Title(strings.Join([]string{title, passphrase}, "\n")).
+				Description(strings.Join([]string{
+					"Note this passphrase down before proceeding.",
+					"It will not be shown again.",
+				}, "\n")).
+				Affirmative("Done"),
+		),
+	)
+	return DialogModel{}.Construct(form, mm.editor.textarea.Width(), func(mm *MainModel) tea.Cmd {
+		return nil
+	})
+}
+
+func (mm *MainModel) rekeyDialog() DialogModel {
+	var confirmed bool
+	var pin string
+	keysStored := config.ConfigFileExists() == nil
+	fields := []huh.Field{
+		huh.NewConfirm().
+			Title("Change this notebook's passphrase?").
+			Description(strings.Join([]string{
+				"A new passphrase will be generated and the notebook will be",
+				"re-encrypted and moved to it. Your current passphrase will",
+				"stop working. Any decoy notebook stays linked.",
+			}, "\n")).
+			Value(&confirmed),
+	}
+	if keysStored {
+		fields = append(fields, huh.NewInput().
+			Title("Enter your PIN to update your stored keys.").
+			Password(true).
+			Value(&pin))
+	}
+	form := huh.NewForm(huh.NewGroup(fields...))
+	return DialogModel{}.Construct(form, mm.editor.textarea.Width(), func(mm *MainModel) tea.Cmd {
+		if !confirmed {
+			mm.messages.SetMessage(MessageInfo, "Cancelled.")
+			return mm.resume()
+		}
+		subkeys, revision, edits := mm.subkeys(), mm.revision, mm.edits
+		nb := proto.Clone(mm.notebook).(*enclaveProto.Notebook)
+		return mm.runOperation(func() tea.Msg {
+			if keysStored {
+				if _, err := config.ReadKeys(pin); err != nil {
+					return rekeyResultMsg{err: err}
+				}
+			}
+			passphrase, newSubkeys, revision, err := notebook.Rekey(subkeys, nb, revision)
+			if err != nil {
+				return rekeyResultMsg{err: err}
+			}
+			msg := rekeyResultMsg{passphrase: passphrase, subkeys: newSubkeys, revision: revision, edits: edits}
+			if keysStored {
+				msg.keysErr = config.WriteKeys(newSubkeys, pin)
+			}
+			return msg
+		})
+	})
+}
+
+func (mm *MainModel) rekeyResult(msg rekeyResultMsg) tea.Cmd {
+	if errors.Is(msg.err, client.ErrConflict) {
+		mm.saveQueued = false
+		cmd := mm.resume()
+		mm.setConflict()
+		return cmd
+	} else if msg.err != nil {
+		cmd := mm.resume()
+		mm.messages.SetMessage(MessageErr, msg.err.Error())
+		return cmd
+	}
+	mm.uskId, mm.uskEd, mm.uskWa = msg.subkeys[0], msg.subkeys[1], msg.subkeys[2]
+	mm.revision = msg.revision
+	mm.conflict = false
+	mm.pending = false
+	mm.saveFailed = false
+	mm.savedEdits = msg.edits
+	mm.messages.SetMessage(MessageOK, "Passphrase changed.")
+	if msg.keysErr != nil {
+		mm.messages.SetMessage(MessageErr, msg.keysErr.Error())
 	}
+	cmd := mm.openDialog(mm.passphraseDialog("New passphrase generated:", msg.passphrase))
+	return tea.Batch(cmd, mm.resume())
+}
+
+func (mm *MainModel) exportDialog() DialogModel {
+	format := export.FORMAT_MARKDOWN
+	homePath, _ := os.UserHomeDir()
+	path := filepath.Join(homePath, fmt.Sprintf("enclave-export-%s", time.Now().Format("2006-01-02")))
+	options := []huh.Option[string]{}
+	for _, f := range export.FORMATS {
+		options = append(options, huh.NewOption(f, f))
+	}
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewSelect[string]().
+				Title("Export notebook").
+				Description(strings.Join([]string{
+					"md: one Markdown file per page in a directory.",
+					"json: a single JSON document. tar, zip: an archive of both.",
+					"Exported files are not encrypted.",
+				}, "\n")).
+				Options(options...).
+				Value(&format),
+			huh.NewInput().
+				Title("Export to:").
+				Validate(func(str string) error {
+					if len(strings.TrimSpace(str)) == 0 || str == "-" {
+						return errors.New("enter a path")
+					}
+					return nil
+				}).
+				Value(&path),
+		),
+	)
+	return DialogModel{}.Construct(form, mm.editor.textarea.Width(), func(mm *MainModel) tea.Cmd {
+		if format != export.FORMAT_MARKDOWN && filepath.Ext(path) == "" {
+			path = fmt.Sprintf("%s.%s", path, format)
+		}
+		err := export.Export(mm.notebook, format, path)
+		if err != nil {
+			mm.messages.SetMessage(MessageErr, err.Error())
+			return nil
+		}
+		mm.messages.SetMessage(MessageOK, fmt.Sprintf("Notebook exported to %s.", path))
+		return nil
+	})
 }
 
-func RunProgram() {
+func (mm *MainModel) importDialog() DialogModel {
+	var path string
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewInput().
+				Title("Import pages from:").
+				Description(strings.Join([]string{
+					"A directory or file of .md and .txt notes, an Enclave JSON export,",
+					"a Simplenote export or Google Keep notes (.json).",
+					"Imported pages are added to the top of this notebook.",
+				}, "\n")).
+				Validate(func(str string) error {
+					if _, err := os.Stat(str); err != nil {
+						return errors.New("no such file or directory")
+					}
+					return nil
+				}).
+				Value(&path),
+		),
+	)
+	return DialogModel{}.Construct(form, mm.editor.textarea.Width(), func(mm *MainModel) tea.Cmd {
+		report, err := importer.Import(mm.notebook, path)
+		if err != nil {
+			mm.messages.SetMessage(MessageErr, err.Error())
+			return nil
+		}
+		if report.Imported > 0 {
+			mm.setNotebook(mm.notebook)
+			mm.edits++
+		}
+		summary := fmt.Sprintf("Imported %d pages", report.Imported)
+		if len(report.Truncated) > 0 {
+			summary += fmt.Sprintf(", truncated %d", len(report.Truncated))
+		}
+		if len(report.Skipped) > 0 {
+			skip := report.Skipped[0]
+			summary += fmt.Sprintf(", skipped %d (%s: %s)", len(report.Skipped), filepath.Base(skip.Name), skip.Reason)
+		}
+		if len(report.Skipped) > 0 || len(report.Truncated) > 0 {
+			mm.messages.SetMessage(MessageWarn, summary+".")
+		} else {
+			mm.messages.SetMessage(MessageOK, summary+". Press ctrl+s to save.")
+		}
+		return nil
+	})
+}
+
+func RunProgram(options Options) {
 	if config.ConfigFileExists() != nil {
-		subkeys, nb, err := setup.Setup()
+		subkeys, nb, revision, err := setup.Setup()
 		if err != nil {
-			offerToRestart(err)
+			offerToRestart(err, options)
 			return
 		}
-		mainModel := MainModel{}.Construct(subkeys, nb)
+		mainModel := MainModel{}.Construct(subkeys, nb, revision, false, false, options)
 		runEditorTui(mainModel)
 	} else {
-		subkeys, nb, err := notebook.RestoreFromConfig()
+		pin, err := setup.Unlock()
+		if err != nil {
+			offerToRestart(err, options)
+			return
+		}
+		subkeys, err := config.ReadKeys(pin)
 		if err != nil {
-			offerToRestart(err)
+			offerToRestart(err, options)
 			return
 		}
-		mainModel := MainModel{}.Construct(subkeys, nb)
+		nb, revision, pending, offline, err := notebook.Load(subkeys)
+		if errors.Is(err, notebook.ErrRollback) && setup.ConfirmRollback(err) {
+			notebook.ForgetRevision(subkeys)
+			nb, revision, pending, offline, err = notebook.Load(subkeys)
+		}
+		if err != nil {
+			offerToRestart(err, options)
+			return
+		}
+		mainModel := MainModel{}.Construct(subkeys, nb, revision, pending, offline, options)
 		runEditorTui(mainModel)
 	}
 }
 
-func offerToRestart(err error) {
+func offerToRestart(err error, options Options) {
 	fmt.Println(err)
 	fmt.Print("Press 'Enter' to restart...")
 	bufio.NewReader(os.Stdin).ReadBytes('\n')
-	RunProgram()
+	RunProgram(options)
 }
 
 func runEditorTui(mainModel MainModel) {
-	p := tea.NewProgram(mainModel, tea.WithAltScreen())
-	if _, err := p.Run(); err != nil {
+	p := tea.NewProgram(mainModel, tea.WithAltScreen(), tea.WithoutSignalHandler())
+	// Write unsaved changes to the local cache before exiting on a signal,
+	// so that they are synced the next time the notebook is opened.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+	go func() {
+		if _, ok := <-signals; ok {
+			p.Send(flushMsg{})
+		}
+	}()
+	m, err := p.Run()
+	if err != nil {
 		os.Exit(1)
 	}
+	if mm, ok := m.(MainModel); ok && mm.panicked {
+		mm.panicCleanup()
+	}
 }
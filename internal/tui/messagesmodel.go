@@ -16,10 +16,23 @@ const (
 	MessageInfo = iota
 	MessageOK   = iota
 	MessageErr  = iota
+	MessageWarn = iota
+)
+
+type SyncStatus uint
+
+const (
+	SyncSynced   = iota
+	SyncDirty    = iota
+	SyncSaving   = iota
+	SyncFailed   = iota
+	SyncConflict = iota
+	SyncOffline  = iota
 )
 
 type MessagesModel struct {
 	Messages string
+	Status   SyncStatus
 	Width    int
 	Height   int
 }
@@ -27,6 +40,7 @@ type MessagesModel struct {
 func (mm MessagesModel) Construct() MessagesModel {
 	return MessagesModel{
 		Messages: "",
+		Status:   SyncSynced,
 		Width:    10,
 		Height:   2,
 	}
@@ -42,7 +56,26 @@ func (mm MessagesModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 }
 
 func (mm MessagesModel) View() string {
-	return mm.Messages
+	var style lipgloss.Style
+	switch mm.Status {
+	case SyncSynced:
+		style = lipgloss.NewStyle().Foreground(lipgloss.Color("#00FF00")).SetString("● Synced")
+	case SyncDirty:
+		style = lipgloss.NewStyle().Foreground(lipgloss.Color("#FFA500")).SetString("● Unsaved")
+	case SyncSaving:
+		style = lipgloss.NewStyle().Foreground(lipgloss.Color("#34beed")).SetString("● Saving")
+	case SyncFailed:
+		style = lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000")).SetString("● Save failed")
+	case SyncConflict:
+		style = lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000")).SetString("● Conflict")
+	default:
+		style = lipgloss.NewStyle().Foreground(lipgloss.Color("#FFA500")).SetString("● Offline")
+	}
+	return fmt.Sprintf("%s  %s", style.Render(), mm.Messages)
+}
+
+func (mm *MessagesModel) SetStatus(status SyncStatus) {
+	mm.Status = status
 }
 
 func (mm *MessagesModel) SetMessage(msgType MessageType, message string) {
@@ -52,6 +85,8 @@ func (mm *MessagesModel) SetMessage(msgType MessageType, message string) {
 		style = lipgloss.NewStyle().Background(lipgloss.Color("#0000FF")).Bold(true).SetString(" INFO ")
 	case MessageOK:
 		style = lipgloss.NewStyle().Background(lipgloss.Color("#00FF00")).Bold(true).SetString("  OK  ")
+	case MessageWarn:
+		style = lipgloss.NewStyle().Background(lipgloss.Color("#FFA500")).Bold(true).SetString(" WARN ")
 	default:
 		style = lipgloss.NewStyle().Background(lipgloss.Color("#FF0000")).Bold(true).SetString("ERROR ")
 	}
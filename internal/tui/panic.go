@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package tui
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/symbolicsoft/enclave/v2/internal/cache"
+	"github.com/symbolicsoft/enclave/v2/internal/ciphers"
+	"github.com/symbolicsoft/enclave/v2/internal/client"
+	"github.com/symbolicsoft/enclave/v2/internal/config"
+	enclaveProto "github.com/symbolicsoft/enclave/v2/internal/proto"
+	"github.com/symbolicsoft/enclave/v2/internal/util"
+	"github.com/symbolicsoft/enclave/v2/internal/watermark"
+)
+
+const PANIC_KEY = "ctrl+g"
+const PANIC_DELETE_TIMEOUT = 5 * time.Second
+
+// panicQuit removes the stored keys, cached notebooks and watermarks, drops
+// the decrypted notebook and exits without rendering anything further.
+func (mm *MainModel) panicQuit() tea.Cmd {
+	config.Delete()
+	cache.Purge()
+	watermark.Purge()
+	for _, page := range mm.notebook.Pages {
+		page.Body = ""
+	}
+	mm.notebook = &enclaveProto.Notebook{}
+	mm.editor.textarea.SetValue("")
+	mm.history = newHistory()
+	mm.dialog, mm.search, mm.find = nil, nil, nil
+	if mm.options.PanicDelete {
+		// Only USK-ID and USK-WA are needed to delete the notebook.
+		ciphers.Wipe(mm.uskEd)
+		mm.uskEd = nil
+	} else {
+		mm.wipeKeys()
+	}
+	mm.panicked = true
+	return tea.Quit
+}
+
+// panicCleanup runs once the terminal has been restored.
+func (mm *MainModel) panicCleanup() {
+	util.ClearScrollback()
+	if mm.options.PanicDelete && mm.uskId != nil {
+		// Notebooks without a registered write key are left alone rather
+		// than registered with a save, which would upload the scrubbed
+		// notebook. The keys are wiped as soon as the delete is done or
+		// the timeout runs out.
+		ctx, cancel := context.WithTimeout(context.Background(), PANIC_DELETE_TIMEOUT)
+		err := client.DeleteNotebookContext(ctx, mm.uskId, mm.uskWa, mm.revision)
+		if errors.Is(err, client.ErrConflict) {
+			if enb, err := client.GetNotebookContext(ctx, mm.uskId); err == nil {
+				client.DeleteNotebookContext(ctx, mm.uskId, mm.uskWa, enb.Revision)
+			}
+		}
+		cancel()
+	}
+	mm.wipeKeys()
+}
+
+func (mm *MainModel) wipeKeys() {
+	for _, sk := range mm.subkeys() {
+		ciphers.Wipe(sk)
+	}
+	mm.uskId, mm.uskEd, mm.uskWa = nil, nil, nil
+}
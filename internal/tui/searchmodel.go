@@ -0,0 +1,216 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package tui
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/symbolicsoft/enclave/v2/internal/notebook"
+	enclaveProto "github.com/symbolicsoft/enclave/v2/internal/proto"
+)
+
+const SEARCH_HITS_MAX = 500
+const SEARCH_CONTEXT_RUNES = 24
+
+var (
+	searchHitStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#34beed"))
+	searchSelectedStyle = lipgloss.NewStyle().
+				Foreground(lipgloss.Color("#34beed")).
+				Bold(true)
+	searchDimStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#808080"))
+	searchErrStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#FF0000"))
+)
+
+type SearchHit struct {
+	pageIndex int
+	line      int
+	col       int
+	context   string
+}
+
+type SearchModel struct {
+	input         textinput.Model
+	notebook      *enclaveProto.Notebook
+	caseSensitive bool
+	regex         bool
+	hits          []SearchHit
+	selected      int
+	err           error
+	width         int
+	height        int
+}
+
+func (sm SearchModel) Construct(nb *enclaveProto.Notebook, width int, height int) SearchModel {
+	ti := textinput.New()
+	ti.Prompt = "Search: "
+	ti.Placeholder = "text or regular expression"
+	ti.Focus()
+	return SearchModel{
+		input:    ti,
+		notebook: nb,
+		hits:     []SearchHit{},
+		width:    width,
+		height:   height,
+	}
+}
+
+func (sm SearchModel) Init() tea.Cmd {
+	return textinput.Blink
+}
+
+func (sm SearchModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "up":
+			if sm.selected > 0 {
+				sm.selected--
+			}
+			return sm, nil
+		case "down":
+			if sm.selected < len(sm.hits)-1 {
+				sm.selected++
+			}
+			return sm, nil
+		case "ctrl+t":
+			sm.caseSensitive = !sm.caseSensitive
+			sm.search()
+			return sm, nil
+		case "ctrl+e":
+			sm.regex = !sm.regex
+			sm.search()
+			return sm, nil
+		}
+	}
+	query := sm.input.Value()
+	sm.input, cmd = sm.input.Update(msg)
+	if query != sm.input.Value() {
+		sm.search()
+	}
+	return sm, cmd
+}
+
+func (sm SearchModel) View() string {
+	lines := []string{sm.input.View()}
+	lines = append(lines, searchDimStyle.Render(fmt.Sprintf(
+		"ctrl+t: case-sensitive %s • ctrl+e: regex %s • enter: go to match • esc: close",
+		onOff(sm.caseSensitive), onOff(sm.regex),
+	)))
+	switch {
+	case sm.err != nil:
+		lines = append(lines, "", searchErrStyle.Render(sm.err.Error()))
+	case len(sm.input.Value()) == 0:
+	case len(sm.hits) == 0:
+		lines = append(lines, "", "No matches.")
+	default:
+		count := fmt.Sprintf("%d matches", len(sm.hits))
+		if len(sm.hits) >= SEARCH_HITS_MAX {
+			count = fmt.Sprintf("First %d matches", SEARCH_HITS_MAX)
+		}
+		lines = append(lines, "", count)
+		visible := sm.height - len(lines)
+		first := 0
+		if visible > 0 && sm.selected >= visible {
+			first = sm.selected - visible + 1
+		}
+		for i := first; i < len(sm.hits) && i-first < visible; i++ {
+			hit := sm.hits[i]
+			title := notebook.PageTitle(sm.notebook.Pages[hit.pageIndex])
+			if utf8.RuneCountInString(title) > 24 {
+				title = string([]rune(title)[:24]) + "…"
+			}
+			line := truncateRunes(fmt.Sprintf("%s:%d  %s", title, hit.line+1, hit.context), sm.width)
+			if i == sm.selected {
+				lines = append(lines, searchSelectedStyle.Render("> "+line))
+			} else {
+				lines = append(lines, "  "+searchHitStyle.Render(line))
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (sm SearchModel) Selected() (SearchHit, bool) {
+	if sm.selected < 0 || sm.selected >= len(sm.hits) {
+		return SearchHit{}, false
+	}
+	return sm.hits[sm.selected], true
+}
+
+func (sm *SearchModel) search() {
+	sm.hits = []SearchHit{}
+	sm.selected = 0
+	sm.err = nil
+	query := sm.input.Value()
+	if len(query) == 0 {
+		return
+	}
+	if !sm.regex {
+		query = regexp.QuoteMeta(query)
+	}
+	if !sm.caseSensitive {
+		query = "(?i)" + query
+	}
+	re, err := regexp.Compile(query)
+	if err != nil {
+		sm.err = err
+		return
+	}
+	for pageIndex, page := range sm.notebook.Pages {
+		for lineIndex, line := range strings.Split(page.Body, "\n") {
+			for _, match := range re.FindAllStringIndex(line, -1) {
+				if match[0] == match[1] {
+					continue
+				}
+				sm.hits = append(sm.hits, SearchHit{
+					pageIndex: pageIndex,
+					line:      lineIndex,
+					col:       utf8.RuneCountInString(line[:match[0]]),
+					context:   searchContext(line, match[0], match[1]),
+				})
+				if len(sm.hits) >= SEARCH_HITS_MAX {
+					return
+				}
+			}
+		}
+	}
+}
+
+func searchContext(line string, start int, end int) string {
+	before := []rune(line[:start])
+	after := []rune(line[end:])
+	prefix, suffix := "", ""
+	if len(before) > SEARCH_CONTEXT_RUNES {
+		before = before[len(before)-SEARCH_CONTEXT_RUNES:]
+		prefix = "…"
+	}
+	if len(after) > SEARCH_CONTEXT_RUNES {
+		after = after[:SEARCH_CONTEXT_RUNES]
+		suffix = "…"
+	}
+	return prefix + string(before) + "[" + line[start:end] + "]" + string(after) + suffix
+}
+
+func truncateRunes(s string, n int) string {
+	if n <= 1 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
@@ -0,0 +1,82 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package tui
+
+import (
+	"strings"
+	"testing"
+
+	enclaveProto "github.com/symbolicsoft/enclave/v2/internal/proto"
+)
+
+func TestSearch(t *testing.T) {
+	nb := &enclaveProto.Notebook{Pages: []*enclaveProto.Page{
+		{Body: "Pets\ncat dog CAT"},
+		{Body: "Greetings\nhéllo cat\n日本語 cat"},
+	}}
+	for _, tc := range []struct {
+		name          string
+		query         string
+		caseSensitive bool
+		regex         bool
+		want          []SearchHit
+		err           bool
+	}{
+		{name: "case-insensitive", query: "cat", want: []SearchHit{
+			{0, 1, 0, "[cat] dog CAT"},
+			{0, 1, 8, "cat dog [CAT]"},
+			{1, 1, 6, "héllo [cat]"},
+			{1, 2, 4, "日本語 [cat]"},
+		}},
+		{name: "case-sensitive", query: "CAT", caseSensitive: true, want: []SearchHit{
+			{0, 1, 8, "cat dog [CAT]"},
+		}},
+		{name: "multi-byte", query: "HÉLLO", want: []SearchHit{
+			{1, 1, 0, "[héllo] cat"},
+		}},
+		{name: "literal", query: "c.t", want: []SearchHit{}},
+		{name: "regex", query: "d.g|本", regex: true, want: []SearchHit{
+			{0, 1, 4, "cat [dog] CAT"},
+			{1, 2, 1, "日[本]語 cat"},
+		}},
+		{name: "empty matches", query: "x*", regex: true, want: []SearchHit{}},
+		{name: "invalid regex", query: "(", regex: true, want: []SearchHit{}, err: true},
+	} {
+		sm := SearchModel{}.Construct(nb, 80, 20)
+		sm.caseSensitive = tc.caseSensitive
+		sm.regex = tc.regex
+		sm.input.SetValue(tc.query)
+		sm.search()
+		if (sm.err != nil) != tc.err {
+			t.Fatalf("%s: got error %v, want error %v", tc.name, sm.err, tc.err)
+		}
+		if len(sm.hits) != len(tc.want) {
+			t.Fatalf("%s: got %v, want %v", tc.name, sm.hits, tc.want)
+		}
+		for i, hit := range tc.want {
+			if sm.hits[i] != hit {
+				t.Fatalf("%s: hit %d: got %v, want %v", tc.name, i, sm.hits[i], hit)
+			}
+		}
+	}
+}
+
+func TestSearchLimits(t *testing.T) {
+	nb := &enclaveProto.Notebook{Pages: []*enclaveProto.Page{
+		{Body: strings.Repeat("a ", SEARCH_HITS_MAX+10)},
+		{Body: strings.Repeat("é", 40) + "x" + strings.Repeat("ü", 40)},
+	}}
+	sm := SearchModel{}.Construct(nb, 80, 20)
+	sm.input.SetValue("a")
+	sm.search()
+	if len(sm.hits) != SEARCH_HITS_MAX {
+		t.Fatalf("got %d hits, want %d", len(sm.hits), SEARCH_HITS_MAX)
+	}
+	sm.input.SetValue("x")
+	sm.search()
+	want := "…" + strings.Repeat("é", SEARCH_CONTEXT_RUNES) + "[x]" + strings.Repeat("ü", SEARCH_CONTEXT_RUNES) + "…"
+	if len(sm.hits) != 1 || sm.hits[0].col != 40 || sm.hits[0].context != want {
+		t.Fatalf("got %v, want column 40 and context %q", sm.hits, want)
+	}
+}
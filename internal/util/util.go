@@ -23,3 +23,11 @@ func ClearManually() {
 	cmd.Stdout = os.Stdout
 	cmd.Run()
 }
+
+func ClearScrollback() {
+	if runtime.GOOS != "windows" {
+		// Erase the scrollback buffer as well as the visible screen.
+		os.Stdout.WriteString("\033[3J\033[H\033[2J")
+	}
+	ClearManually()
+}
@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: © 2024 Nadim Kobeissi <nadim@symbolic.software>
+// SPDX-License-Identifier: GPL-2.0-only
+
+package watermark
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/symbolicsoft/enclave/v2/internal/ciphers"
+	"github.com/symbolicsoft/enclave/v2/internal/config"
+	"golang.org/x/crypto/blake2s"
+)
+
+const WATERMARK_HEADER = "enclave-watermark"
+const WATERMARK_VERSION = 1
+const WATERMARK_CONTEXT = "Enclave Watermark"
+
+func EnsureDir() string {
+	watermarkPath := filepath.Join(config.EnsureDir(), "watermarks")
+	if _, err := os.Stat(watermarkPath); os.IsNotExist(err) {
+		os.MkdirAll(watermarkPath, 0o700)
+	}
+	return watermarkPath
+}
+
+// Purge removes the watermarks of every notebook.
+func Purge() error {
+	return os.RemoveAll(filepath.Join(config.EnsureDir(), "watermarks"))
+}
+
+// Read returns the watermark of a notebook, and whether it has one.
+func Read(subkeys [3]ciphers.Subkey) (uint64, bool, error) {
+	watermarkFileBytes, err := os.ReadFile(watermarkPath(subkeys[0]))
+	if os.IsNotExist(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	watermarkFile := strings.Split(string(watermarkFileBytes), "\n")
+	if len(watermarkFile) < 3 || watermarkFile[0] != watermarkFileHeader() {
+		return 0, false, errors.New("could not decode watermark file")
+	}
+	nonce, errNonce := hex.DecodeString(watermarkFile[1])
+	data, errData := hex.DecodeString(watermarkFile[2])
+	if (errNonce != nil) || (errData != nil) {
+		return 0, false, errors.New("could not decode watermark file")
+	}
+	pt, err := ciphers.Decrypt(subkeys[1], ciphers.Ciphertext{
+		Data:  data,
+		Nonce: nonce,
+	}, watermarkAd(subkeys[0]))
+	if err != nil || len(pt) != 8 {
+		return 0, false, errors.New("could not authenticate watermark file")
+	}
+	return binary.BigEndian.Uint64(pt), true, nil
+}
+
+// Write records revision as the highest revision of a notebook seen on
+// this device. Watermarks are encrypted under USK-ED and bound to USK-ID,
+// so that they can be neither read nor lowered without the notebook keys.
+func Write(subkeys [3]ciphers.Subkey, revision uint64) error {
+	ct, err := ciphers.Encrypt(subkeys[1], binary.BigEndian.AppendUint64([]byte{}, revision), watermarkAd(subkeys[0]))
+	if err != nil {
+		return err
+	}
+	watermarkFilePath := watermarkPath(subkeys[0])
+	tmpPath := watermarkFilePath + ".tmp"
+	err = os.WriteFile(tmpPath, []byte(strings.Join([]string{
+		watermarkFileHeader(),
+		hex.EncodeToString(ct.Nonce),
+		hex.EncodeToString(ct.Data),
+	}, "\n")), 0o600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, watermarkFilePath)
+}
+
+func Delete(subkeys [3]ciphers.Subkey) {
+	os.Remove(watermarkPath(subkeys[0]))
+}
+
+func watermarkPath(uskId ciphers.Subkey) string {
+	name := blake2s.Sum256(append([]byte(WATERMARK_HEADER), uskId...))
+	return filepath.Join(EnsureDir(), hex.EncodeToString(name[:]))
+}
+
+func watermarkAd(uskId ciphers.Subkey) []byte {
+	return append([]byte(WATERMARK_CONTEXT), uskId...)
+}
+
+func watermarkFileHeader() string {
+	return fmt.Sprintf("%s %d", WATERMARK_HEADER, WATERMARK_VERSION)
+}